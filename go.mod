@@ -2,13 +2,17 @@ module github.com/go-fluid/cli
 
 go 1.20
 
-require github.com/go-fluid/fluid v0.0.0-20211021084216-aaac67c57374
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/go-fluid/fluid v0.0.0-20211021084216-aaac67c57374
+	github.com/go-playground/validator/v10 v10.9.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/go-diary/diary v0.0.0-20210101215357-b1f47bcad4b4 // indirect
 	github.com/go-playground/locales v0.14.0 // indirect
 	github.com/go-playground/universal-translator v0.18.0 // indirect
-	github.com/go-playground/validator/v10 v10.9.0 // indirect
 	github.com/go-stack/stack v1.8.0 // indirect
 	github.com/go-uniform/uniform v0.0.0-20211014200403-c5003cf569d9 // indirect
 	github.com/leodido/go-urn v1.2.1 // indirect
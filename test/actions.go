@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/go-fluid/fluid"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// stubMarker tags generated files that are only a starting point, an existing stub in the output directory replaces the newly generated one
+const stubMarker = "fluid:stub"
+
+// actionHandler describes an entity action for the api routes, the logic handlers and the portal buttons
+type actionHandler struct {
+	Entity      string
+	Name        string
+	Description string
+	Topic       string
+	Func        string
+	Method      string
+	Path        string
+	Record      bool
+	Authorized  bool
+	Download    bool
+	Request     string // go type of the request contract, empty without one
+	Response    string // go type of the response contract, empty without one
+}
+
+// actionTopic is the nats topic the api publishes an action on and the logic service subscribes to
+func actionTopic(entity fluid.Entity, action fluid.EntityAction) string {
+	return fmt.Sprintf("action.%s.%s", kebabCase(entity.NamePlural), kebabCase(action.Name))
+}
+
+func newActionHandler(project fluid.Project, entity fluid.Entity, action fluid.EntityAction) (actionHandler, error) {
+	handler := actionHandler{
+		Entity:      entity.NamePlural,
+		Name:        action.Name,
+		Description: strings.TrimSpace(action.Description),
+		Topic:       actionTopic(entity, action),
+		Func:        "handle" + pascalCase(entity.NamePlural) + pascalCase(action.Name),
+		Method:      strings.ToUpper(action.Method),
+		Path:        entityActionPath(entity, action),
+		Record:      strings.ToLower(action.Type) == fluid.EntityActionTypeRecord,
+		Authorized:  !action.DisableAuthorizationRequirement,
+		Download:    action.EnableFileDownloadResponse,
+	}
+
+	requestKey := action.RequestBodyContractKey
+	if requestKey == "" {
+		requestKey = action.RequestParametersContractKey
+	}
+	if requestKey != "" {
+		contract, ok := findContract(project, requestKey)
+		if !ok {
+			return handler, validationError(fmt.Errorf("action '%s': contract '%s' does not exist", action.Name, requestKey))
+		}
+		handler.Request = "contracts." + contractSchemaName(contract)
+	}
+
+	if action.ResponseBodyContractKey != "" && !action.EnableFileDownloadResponse {
+		contract, ok := findContract(project, action.ResponseBodyContractKey)
+		if !ok {
+			return handler, validationError(fmt.Errorf("action '%s': contract '%s' does not exist", action.Name, action.ResponseBodyContractKey))
+		}
+		handler.Response = "contracts." + contractSchemaName(contract)
+	}
+
+	return handler, nil
+}
+
+func projectActionHandlers(project fluid.Project) ([]actionHandler, error) {
+	var handlers []actionHandler
+	for _, entity := range project.Entities {
+		for _, action := range entity.Actions {
+			handler, err := newActionHandler(project, entity, action)
+			if err != nil {
+				return nil, fmt.Errorf("entity '%s': %w", entity.NameSingular, err)
+			}
+			handlers = append(handlers, handler)
+		}
+	}
+	return handlers, nil
+}
+
+// validateEntityActions checks that the actions of an entity get distinct topics, handlers and routes, the kebab case
+// name of an action is part of all of them
+func validateEntityActions(project fluid.Project) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for i, entity := range project.Entities {
+		names := map[string]int{}
+		for j, action := range entity.Actions {
+			name := kebabCase(action.Name)
+			if name == "" {
+				continue
+			}
+			previousIndex, ok := names[name]
+			if !ok {
+				names[name] = j
+				continue
+			}
+
+			previous := entity.Actions[previousIndex]
+			message := fmt.Sprintf("action '%s' clashes with action '%s', both are named '%s' in their topic, handler and route", action.Name, previous.Name, name)
+			if strings.ToLower(action.Type) != strings.ToLower(previous.Type) {
+				message = fmt.Sprintf("action '%s' clashes with action '%s', the list route /%s/actions/%s also matches the record route /%s/{id}/%s",
+					action.Name, previous.Name, kebabCase(entity.NamePlural), name, kebabCase(entity.NamePlural), name)
+			}
+			diagnostics = append(diagnostics, Diagnostic{Path: fmt.Sprintf("/entities/%d/actions/%d/name", i, j), Severity: SeverityError, Message: message})
+		}
+	}
+
+	return diagnostics
+}
+
+func usesContracts(handlers ...actionHandler) bool {
+	for _, handler := range handlers {
+		if handler.Request != "" || handler.Response != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// goModulePath reads the module path of a base template so generated packages can import each other
+func goModulePath(directory string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(directory, "go.mod"))
+	if err != nil {
+		return "", ioError(err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "module ") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module")), `"`), nil
+		}
+	}
+	return "", errors.New("go.mod has no module directive")
+}
+
+const apiRoutesFileTemplate = `package actions
+
+// Route binds an entity action endpoint to the logic topic that handles it
+type Route struct {
+	Entity     string
+	Action     string
+	Method     string
+	Path       string
+	Topic      string
+	Record     bool // the path holds the {id} of the record the action applies to
+	Authorized bool
+	Download   bool // the response is a file rather than json
+}
+
+// Routes lists every entity action of the project
+var Routes = []Route{
+{{- range . }}
+	{
+		Entity:     "{{ .Entity | KebabCase }}",
+		Action:     "{{ .Name | KebabCase }}",
+		Method:     "{{ .Method }}",
+		Path:       "{{ .Path }}",
+		Topic:      "{{ .Topic }}",
+		Record:     {{ .Record }},
+		Authorized: {{ .Authorized }},
+		Download:   {{ .Download }},
+	},
+{{- end }}
+}
+
+// Register adds every route using register, which wraps the router of the service
+func Register(register func(route Route) error) error {
+	for _, route := range Routes {
+		if err := register(route); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+`
+
+const logicHandlersFileTemplate = `package actions
+
+import (
+	"encoding/json"
+	"fmt"
+{{- if UsesContracts }}
+	"{{ Module }}/service/contracts"
+{{- end }}
+)
+
+// Handler handles the json encoded request of an entity action and returns the encoded response
+type Handler func(data []byte) ([]byte, error)
+
+// Request is the envelope the api publishes an entity action request in
+type Request struct {
+	Id   string          ` + "`json:\"id,omitempty\"`" + `
+	Body json.RawMessage ` + "`json:\"body,omitempty\"`" + `
+}
+
+func decodeRequest(data []byte, body interface{}) (Request, error) {
+	var request Request
+	if err := json.Unmarshal(data, &request); err != nil {
+		return request, err
+	}
+	if body != nil && len(request.Body) > 0 {
+		if err := json.Unmarshal(request.Body, body); err != nil {
+			return request, err
+		}
+	}
+	return request, nil
+}
+
+// Handlers maps the topic of every entity action to its handler, the handler funcs live in the stub files of this package
+var Handlers = map[string]Handler{
+{{- range . }}
+	"{{ .Topic }}": func(data []byte) ([]byte, error) {
+{{- if .Request }}
+		var body {{ .Request }}
+{{- end }}
+{{- if .Record }}
+		request, err := decodeRequest(data, {{ if .Request }}&body{{ else }}nil{{ end }})
+		if err != nil {
+			return nil, err
+		}
+{{- else }}
+		if _, err := decodeRequest(data, {{ if .Request }}&body{{ else }}nil{{ end }}); err != nil {
+			return nil, err
+		}
+{{- end }}
+{{- if or .Download .Response }}
+		response, err := {{ template "call" . }}
+		if err != nil {
+			return nil, err
+		}
+{{- if .Download }}
+		return response, nil
+{{- else }}
+		return json.Marshal(response)
+{{- end }}
+{{- else }}
+		return nil, {{ template "call" . }}
+{{- end }}
+	},
+{{- end }}
+}
+
+// Subscribe registers every handler using subscribe, which wraps the nats connection of the service. The base logic
+// template does not call it, wire it up once where the service connects to nats, for example:
+//
+//	err := actions.Subscribe(func(topic string, handler actions.Handler) error {
+//		_, err := conn.Subscribe(topic, func(msg *nats.Msg) {
+//			response, err := handler(msg.Data)
+//			if err != nil {
+//				// report the error, without a reply the request times out in the api
+//				return
+//			}
+//			_ = msg.Respond(response)
+//		})
+//		return err
+//	})
+func Subscribe(subscribe func(topic string, handler Handler) error) error {
+	for topic, handler := range Handlers {
+		if err := subscribe(topic, handler); err != nil {
+			return fmt.Errorf("action '%s': %w", topic, err)
+		}
+	}
+	return nil
+}
+
+{{- define "call" }}{{ .Func }}({{ if .Record }}request.Id{{ if .Request }}, {{ end }}{{ end }}{{ if .Request }}body{{ end }}){{ end }}
+`
+
+const logicHandlerStubTemplate = `// ` + stubMarker + ` generated once as a starting point, this file is kept when the project is regenerated
+
+package actions
+
+import (
+	"errors"
+{{- if UsesContracts . }}
+	"{{ Module }}/service/contracts"
+{{- end }}
+)
+
+// {{ .Func }} handles the '{{ .Name }}' action of {{ .Entity | CamelCase }}{{ if .Description }}: {{ .Description }}{{ end }}
+func {{ .Func }}({{ if .Record }}id string{{ if .Request }}, {{ end }}{{ end }}{{ if .Request }}request {{ .Request }}{{ end }}) ({{ if .Download }}[]byte, {{ else if .Response }}{{ .Response }}, {{ end }}error) {
+	// todo: implement the action, it is only reached once actions.Subscribe in handlers.go is wired into the service
+	return {{ if .Download }}nil, {{ else if .Response }}{{ .Response }}{}, {{ end }}errors.New("action '{{ .Name | KebabCase }}' of {{ .Entity | KebabCase }} is not implemented")
+}
+`
+
+func executeTemplateFile(path, name, text string, funcs template.FuncMap, data interface{}) error {
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return fmt.Errorf("parse %s template: %w", name, err)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return ioError(err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	if err := tmpl.Execute(file, data); err != nil {
+		return fmt.Errorf("execute %s template: %w", name, err)
+	}
+	return nil
+}
+
+// buildApiRoutesFile writes the route table of the entity actions into the api service
+var buildApiRoutesFile = func(project fluid.Project, directory string) error {
+	handlers, err := projectActionHandlers(project)
+	if err != nil {
+		return err
+	}
+
+	actionsDirectory := filepath.Join(directory, "service", "actions")
+	if err := os.MkdirAll(actionsDirectory, os.ModePerm); err != nil {
+		return ioError(err)
+	}
+
+	return executeTemplateFile(filepath.Join(actionsDirectory, "routes.go"), "routes", apiRoutesFileTemplate, template.FuncMap{
+		"KebabCase": kebabCase,
+	}, handlers)
+}
+
+// buildLogicHandlerFiles writes the nats handlers of the entity actions into the logic service along with a stub per action
+var buildLogicHandlerFiles = func(project fluid.Project, directory string) error {
+	handlers, err := projectActionHandlers(project)
+	if err != nil {
+		return err
+	}
+
+	module, err := goModulePath(directory)
+	if err != nil {
+		return fmt.Errorf("logic template: %w", err)
+	}
+
+	actionsDirectory := filepath.Join(directory, "service", "actions")
+	if err := os.MkdirAll(actionsDirectory, os.ModePerm); err != nil {
+		return ioError(err)
+	}
+
+	funcs := template.FuncMap{
+		"Module": func() string {
+			return module
+		},
+		"UsesContracts": func(handler ...actionHandler) bool {
+			if len(handler) > 0 {
+				return usesContracts(handler...)
+			}
+			return usesContracts(handlers...)
+		},
+		"CamelCase": camelCase,
+		"KebabCase": kebabCase,
+	}
+
+	if err := executeTemplateFile(filepath.Join(actionsDirectory, "handlers.go"), "handlers", logicHandlersFileTemplate, funcs, handlers); err != nil {
+		return err
+	}
+
+	for _, handler := range handlers {
+		stubFileName := fmt.Sprintf("%s.go", snakeCase(fmt.Sprintf("%s %s", handler.Entity, handler.Name)))
+		if err := executeTemplateFile(filepath.Join(actionsDirectory, stubFileName), "handler stub", logicHandlerStubTemplate, funcs, handler); err != nil {
+			return fmt.Errorf("action '%s': %w", handler.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// isStubContent reports whether a generated file is a stub, the marker is on its first line
+func isStubContent(data []byte) bool {
+	line := data
+	if index := bytes.IndexByte(data, '\n'); index >= 0 {
+		line = data[:index]
+	}
+	return bytes.Contains(line, []byte(stubMarker))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-fluid/fluid"
+)
+
+func TestValidateEntityActionsReportsClashes(t *testing.T) {
+	project := fluid.Project{
+		Entities: []fluid.Entity{
+			{
+				NameSingular: "Order",
+				NamePlural:   "Orders",
+				Actions: []fluid.EntityAction{
+					{Name: "Archive", Method: "PUT", Type: fluid.EntityActionTypeRecord},
+					{Name: "Export", Method: "GET", Type: fluid.EntityActionTypeList},
+					{Name: "archive", Method: "POST", Type: fluid.EntityActionTypeList},
+					{Name: "export", Method: "POST", Type: fluid.EntityActionTypeList},
+				},
+			},
+		},
+	}
+
+	diagnostics := validateEntityActions(project)
+	if len(diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %v", diagnostics)
+	}
+	if diagnostics[0].Path != "/entities/0/actions/2/name" || !strings.Contains(diagnostics[0].Message, "also matches the record route /orders/{id}/archive") {
+		t.Errorf("expected the list and record routes to clash, got %s", diagnostics[0])
+	}
+	if diagnostics[1].Path != "/entities/0/actions/3/name" || !strings.Contains(diagnostics[1].Message, "both are named 'export'") {
+		t.Errorf("expected the action names to clash, got %s", diagnostics[1])
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-fluid/fluid"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	AttributeTypeString  = "string"
+	AttributeTypeInteger = "integer"
+	AttributeTypeDecimal = "decimal"
+	AttributeTypeBoolean = "boolean"
+)
+
+// attributeValueTypes maps attribute value types to the portal value type used by the attributes editor
+var attributeValueTypes = map[string]string{
+	AttributeTypeString:  entityFieldPortalTypes[fluid.EntityFieldTypeString].ValueType,
+	AttributeTypeInteger: entityFieldPortalTypes[fluid.EntityFieldTypeInteger].ValueType,
+	AttributeTypeDecimal: entityFieldPortalTypes[fluid.EntityFieldTypeDecimal].ValueType,
+	AttributeTypeBoolean: entityFieldPortalTypes[fluid.EntityFieldTypeBoolean].ValueType,
+}
+
+var attributeKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// AttributeKey constrains a single key of an attribute field
+type AttributeKey struct {
+	Key         string `json:"key"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type"`
+	IsOptional  bool   `json:"isOptional,omitempty"`
+}
+
+// AttributeConstraint restricts the keys and value types of an attribute field, fields without constraints accept any key and value
+type AttributeConstraint struct {
+	Field          string         `json:"field"`
+	Keys           []AttributeKey `json:"keys"`
+	AllowOtherKeys bool           `json:"allowOtherKeys,omitempty"`
+}
+
+func isAttributeField(field fluid.EntityField) bool {
+	return strings.ToLower(field.Type) == fluid.EntityFieldTypeAttribute
+}
+
+func (e EntityExtension) attributeConstraint(field fluid.EntityField) *AttributeConstraint {
+	for i, constraint := range e.Attributes {
+		if camelCase(constraint.Field) == camelCase(field.Name) {
+			return &e.Attributes[i]
+		}
+	}
+	return nil
+}
+
+func validateAttributeConstraints(project fluid.Project, extensions ProjectExtensions) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for i, entity := range project.Entities {
+		for j, constraint := range extensions.entity(entity).Attributes {
+			pointer := fmt.Sprintf("/entities/%d/attributes/%d", i, j)
+
+			field, ok := findEntityField(entity, constraint.Field)
+			if !ok {
+				diagnostics = append(diagnostics, Diagnostic{Path: pointer + "/field", Severity: SeverityError, Message: fmt.Sprintf("entity '%s' has no field '%s'", entity.NameSingular, constraint.Field)})
+			} else if !isAttributeField(field) {
+				diagnostics = append(diagnostics, Diagnostic{Path: pointer + "/field", Severity: SeverityError, Message: fmt.Sprintf("field '%s' of entity '%s' is not an attribute field", field.Name, entity.NameSingular)})
+			} else if field.EnableMultipleValueSupport {
+				diagnostics = append(diagnostics, Diagnostic{Path: pointer + "/field", Severity: SeverityError, Message: fmt.Sprintf("field '%s' of entity '%s' supports multiple values which attribute constraints do not", field.Name, entity.NameSingular)})
+			}
+
+			keys := map[string]bool{}
+			for k, key := range constraint.Keys {
+				if strings.TrimSpace(key.Key) == "" {
+					diagnostics = append(diagnostics, Diagnostic{Path: fmt.Sprintf("%s/keys/%d/key", pointer, k), Severity: SeverityError, Message: "is required"})
+				} else if !attributeKeyPattern.MatchString(key.Key) {
+					diagnostics = append(diagnostics, Diagnostic{Path: fmt.Sprintf("%s/keys/%d/key", pointer, k), Severity: SeverityError, Message: fmt.Sprintf("attribute key '%s' may only contain letters, digits, '_', '-' and '.'", key.Key)})
+				} else if keys[key.Key] {
+					diagnostics = append(diagnostics, Diagnostic{Path: fmt.Sprintf("%s/keys/%d/key", pointer, k), Severity: SeverityError, Message: fmt.Sprintf("attribute key '%s' is defined more than once", key.Key)})
+				}
+				keys[key.Key] = true
+
+				if _, ok := attributeValueTypes[key.Type]; !ok {
+					diagnostics = append(diagnostics, Diagnostic{
+						Path:     fmt.Sprintf("%s/keys/%d/type", pointer, k),
+						Severity: SeverityError,
+						Message:  fmt.Sprintf("'%s' is not a valid attribute type, expected one of: %s", key.Type, strings.Join(attributeTypeNames(), ", ")),
+					})
+				}
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+func attributeTypeNames() []string {
+	names := make([]string, 0, len(attributeValueTypes))
+	for name := range attributeValueTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func findEntityField(entity fluid.Entity, name string) (fluid.EntityField, bool) {
+	for _, field := range entity.Fields {
+		if camelCase(field.Name) == camelCase(name) {
+			return field, true
+		}
+	}
+	return fluid.EntityField{}, false
+}
+
+func hasAttributeConstraints(project fluid.Project, extensions ProjectExtensions) bool {
+	for _, entity := range project.Entities {
+		if len(extensions.entity(entity).Attributes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+const attributesFileTemplate = `package entities
+
+import (
+	"fmt"
+	"math"
+)
+
+// AttributeConstraint restricts the value of a single attribute key
+type AttributeConstraint struct {
+	Type       string
+	IsOptional bool
+}
+
+func validateAttributes(name string, attributes map[string]interface{}, constraints map[string]AttributeConstraint, allowOtherKeys bool) error {
+	for key, constraint := range constraints {
+		value, ok := attributes[key]
+		if !ok || value == nil {
+			if !constraint.IsOptional {
+				return fmt.Errorf("%s: attribute '%s' is required", name, key)
+			}
+			continue
+		}
+		if !isAttributeValueType(value, constraint.Type) {
+			return fmt.Errorf("%s: attribute '%s' must be of type '%s'", name, key, constraint.Type)
+		}
+	}
+
+	if !allowOtherKeys {
+		for key := range attributes {
+			if _, ok := constraints[key]; !ok {
+				return fmt.Errorf("%s: attribute '%s' is not allowed", name, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+func isAttributeValueType(value interface{}, valueType string) bool {
+	switch valueType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "integer":
+		switch v := value.(type) {
+		case int, int32, int64:
+			return true
+		case float64:
+			// numbers decoded from json are float64, whole numbers are integers
+			return !math.IsInf(v, 0) && v == math.Trunc(v)
+		}
+	case "decimal":
+		switch value.(type) {
+		case int, int32, int64, float32, float64:
+			return true
+		}
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	}
+	return false
+}
+`
+
+// buildAttributesFile writes the attribute validation helpers shared by the generated entities
+var buildAttributesFile = func(directory string) error {
+	attributesFilePath := filepath.Join(directory, "attributes.go")
+	if err := ioutil.WriteFile(attributesFilePath, []byte(attributesFileTemplate), os.ModePerm); err != nil {
+		return ioError(err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-fluid/fluid"
+	"strings"
+)
+
+// auditField is an implicit field maintained by the services rather than entered by users, it is hidden from forms
+type auditField struct {
+	Name         string
+	Description  string
+	EntityType   string
+	ContractType string
+	Optional     bool
+	Header       bool // shown as a list header in the portals
+	PasswordOnly bool // only added to entities that have a password field
+}
+
+var auditFields = []auditField{
+	{
+		Name:         "Created At",
+		Description:  "The moment the record was created.",
+		EntityType:   fluid.EntityFieldTypeDateTime,
+		ContractType: fluid.ContractFieldTypeDateTime,
+		Header:       true,
+	},
+	{
+		Name:         "Modified At",
+		Description:  "The moment the record was last modified.",
+		EntityType:   fluid.EntityFieldTypeDateTime,
+		ContractType: fluid.ContractFieldTypeDateTime,
+		Header:       true,
+	},
+	{
+		Name:         "Deleted At",
+		Description:  "The moment the record was soft deleted, empty while the record is active.",
+		EntityType:   fluid.EntityFieldTypeDateTime,
+		ContractType: fluid.ContractFieldTypeDateTime,
+		Optional:     true,
+	},
+	{
+		Name:         "Locked At",
+		Description:  "The moment the account was locked after too many failed login attempts.",
+		EntityType:   fluid.EntityFieldTypeDateTime,
+		Optional:     true,
+		PasswordOnly: true,
+	},
+	{
+		Name:         "Login At",
+		Description:  "The moment of the account's last successful login.",
+		EntityType:   fluid.EntityFieldTypeDateTime,
+		Optional:     true,
+		PasswordOnly: true,
+	},
+	{
+		Name:         "Login Attempts",
+		Description:  "The number of failed login attempts since the last successful login.",
+		EntityType:   fluid.EntityFieldTypeInteger,
+		PasswordOnly: true,
+	},
+}
+
+func hasPasswordField(entity fluid.Entity) bool {
+	for _, field := range entity.Fields {
+		if strings.ToLower(field.Type) == fluid.EntityFieldTypePassword {
+			return true
+		}
+	}
+	return false
+}
+
+// entityAuditFields returns the hidden fields every entity carries, plus the login tracking fields for entities with a password
+func entityAuditFields(entity fluid.Entity) []fluid.EntityField {
+	hasPassword := hasPasswordField(entity)
+
+	var fields []fluid.EntityField
+	for _, audit := range auditFields {
+		if audit.PasswordOnly && !hasPassword {
+			continue
+		}
+		fields = append(fields, fluid.EntityField{
+			Name:        audit.Name,
+			Description: audit.Description,
+			Type:        audit.EntityType,
+			IsOptional:  audit.Optional,
+			NotEditable: true,
+			NotHeader:   !audit.Header,
+		})
+	}
+	return fields
+}
+
+// contractAuditFields returns the hidden fields of response contracts, only the record timestamps apply since contracts are not accounts
+func contractAuditFields(contract fluid.Contract) []fluid.ContractField {
+	if strings.ToLower(contract.Type) != fluid.ContractTypeResponse {
+		return nil
+	}
+
+	var fields []fluid.ContractField
+	for _, audit := range auditFields {
+		if audit.ContractType == "" {
+			continue
+		}
+		fields = append(fields, fluid.ContractField{
+			Name:        audit.Name,
+			Description: audit.Description,
+			Type:        audit.ContractType,
+		})
+	}
+	return fields
+}
+
+// isAuditFieldName reports whether a schema field would clash with one of the given audit fields
+func isAuditFieldName(name string, auditFieldNames []string) bool {
+	for _, auditFieldName := range auditFieldNames {
+		if camelCase(auditFieldName) == camelCase(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// entityAuditFieldNames names the audit fields an entity actually gets, the login tracking fields only with a password
+func entityAuditFieldNames(entity fluid.Entity) []string {
+	var names []string
+	for _, field := range entityAuditFields(entity) {
+		names = append(names, field.Name)
+	}
+	return names
+}
+
+func contractAuditFieldNames(contract fluid.Contract) []string {
+	var names []string
+	for _, field := range contractAuditFields(contract) {
+		names = append(names, field.Name)
+	}
+	return names
+}
+
+func contractAuditFieldGoType(field fluid.ContractField) (string, error) {
+	t, err := lookupGoType(contractFieldGoTypes, "contract", field.Type)
+	if err != nil {
+		return "", err
+	}
+	for _, audit := range auditFields {
+		if audit.Name == field.Name {
+			return goTypeName(t, false, audit.Optional), nil
+		}
+	}
+	return t.Name, nil
+}
+
+// checkAuditFieldNames fails generation when a schema field would produce a duplicate of an audit field
+func checkAuditFieldNames(kind, name string, fieldNames, auditFieldNames []string) error {
+	for _, fieldName := range fieldNames {
+		if isAuditFieldName(fieldName, auditFieldNames) {
+			return validationError(fmt.Errorf("%s '%s': field '%s' clashes with the implicit '%s' audit field", kind, name, fieldName, camelCase(fieldName)))
+		}
+	}
+	return nil
+}
+
+func entityFieldNames(entity fluid.Entity) []string {
+	names := make([]string, len(entity.Fields))
+	for i, field := range entity.Fields {
+		names[i] = field.Name
+	}
+	return names
+}
+
+func contractFieldNames(contract fluid.Contract) []string {
+	names := make([]string, len(contract.Fields))
+	for i, field := range contract.Fields {
+		names[i] = field.Name
+	}
+	return names
+}
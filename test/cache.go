@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// releaseRecord is written next to every extracted release as <tag>.json, so the cache can be verified later on
+type releaseRecord struct {
+	TemplateLock
+	TreeDigest string `json:"treeDigest"` // digest of the extracted files
+}
+
+// cachedRelease is a release directory found in the cache of a base template
+type cachedRelease struct {
+	Template  string
+	Tag       string
+	Directory string
+	Size      int64 // size of the extracted files and the tarball
+	Latest    bool
+}
+
+// treeDigest hashes the relative path and content digest of every regular file below a directory in lexical order
+func treeDigest(directory string) (string, error) {
+	hash := sha256.New()
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+		digest, err := fileDigest(path)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(hash, "%s %s\n", filepath.ToSlash(relativePath), digest)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return digestPrefix + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// selectTemplateRepositories keeps the named base templates in their usual order, without names all of them are kept
+func selectTemplateRepositories(templateRepositories []BaseTemplateRepository, names []string) ([]BaseTemplateRepository, error) {
+	if len(names) <= 0 {
+		return templateRepositories, nil
+	}
+
+	selected := map[string]bool{}
+	for _, name := range names {
+		found := false
+		for _, templateRepository := range templateRepositories {
+			found = found || templateRepository.Name == name
+		}
+		if !found {
+			return nil, usageError(fmt.Errorf("unknown template '%s'", name))
+		}
+		selected[name] = true
+	}
+
+	var result []BaseTemplateRepository
+	for _, templateRepository := range templateRepositories {
+		if selected[templateRepository.Name] {
+			result = append(result, templateRepository)
+		}
+	}
+	return result, nil
+}
+
+func releaseRecordPath(templateRepository BaseTemplateRepository, tag string) string {
+	return filepath.Join(templateRepository.CacheDirectory, tag+".json")
+}
+
+var writeReleaseRecord = func(templateRepository BaseTemplateRepository, release TemplateLock) error {
+	digest, err := treeDigest(filepath.Join(templateRepository.CacheDirectory, release.Tag))
+	if err != nil {
+		return ioError(err)
+	}
+	data, err := json.MarshalIndent(releaseRecord{TemplateLock: release, TreeDigest: digest}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(releaseRecordPath(templateRepository, release.Tag), append(data, '\n'), 0644); err != nil {
+		return ioError(err)
+	}
+	return nil
+}
+
+// readReleaseRecord returns nil without an error for releases cached before records were written
+var readReleaseRecord = func(templateRepository BaseTemplateRepository, tag string) (*releaseRecord, error) {
+	data, err := ioutil.ReadFile(releaseRecordPath(templateRepository, tag))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, ioError(err)
+	}
+	var record releaseRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, cacheError(fmt.Errorf("release record '%s': %w", tag, err))
+	}
+	return &record, nil
+}
+
+func directorySize(path string) int64 {
+	var size int64
+	_ = filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+func formatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", size, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// compareTags orders release tags naturally so that v1.10.0 comes after v1.9.0, numbers are compared by value
+func compareTags(a, b string) int {
+	split := func(tag string) []string {
+		var parts []string
+		for i := 0; i < len(tag); {
+			j := i + 1
+			for j < len(tag) && unicode.IsDigit(rune(tag[j])) == unicode.IsDigit(rune(tag[i])) {
+				j++
+			}
+			parts = append(parts, tag[i:j])
+			i = j
+		}
+		return parts
+	}
+
+	partsA, partsB := split(a), split(b)
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		numberA, errA := strconv.Atoi(partsA[i])
+		numberB, errB := strconv.Atoi(partsB[i])
+		switch {
+		case errA == nil && errB == nil && numberA != numberB:
+			if numberA < numberB {
+				return -1
+			}
+			return 1
+		case (errA != nil || errB != nil) && partsA[i] != partsB[i]:
+			return strings.Compare(partsA[i], partsB[i])
+		}
+	}
+	return len(partsA) - len(partsB)
+}
+
+// listCachedReleases returns the cached releases of a base template, newest tag first
+var listCachedReleases = func(templateRepository BaseTemplateRepository) ([]cachedRelease, error) {
+	entries, err := ioutil.ReadDir(templateRepository.CacheDirectory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, ioError(err)
+	}
+
+	latest, _ := os.Readlink(filepath.Join(templateRepository.CacheDirectory, "latest"))
+
+	var releases []cachedRelease
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		directory := filepath.Join(templateRepository.CacheDirectory, entry.Name())
+		release := cachedRelease{
+			Template:  templateRepository.Name,
+			Tag:       entry.Name(),
+			Directory: directory,
+			Size:      directorySize(directory),
+			Latest:    latest != "" && filepath.Base(latest) == entry.Name(),
+		}
+		if info, err := os.Stat(directory + ".tar.gz"); err == nil {
+			release.Size += info.Size()
+		}
+		releases = append(releases, release)
+	}
+
+	sort.SliceStable(releases, func(i, j int) bool {
+		return compareTags(releases[i].Tag, releases[j].Tag) > 0
+	})
+	return releases, nil
+}
+
+// removeCachedRelease deletes the extracted files, tarball and record of a release
+var removeCachedRelease = func(release cachedRelease) error {
+	for _, path := range []string{release.Directory, release.Directory + ".tar.gz", release.Directory + ".json"} {
+		if err := os.RemoveAll(path); err != nil {
+			return ioError(err)
+		}
+	}
+	return nil
+}
+
+// pruneCache removes all but the keep newest releases of every base template, the latest release and releases
+// pinned in the lock are always kept
+var pruneCache = func(keep int, lock *LockFile) ([]cachedRelease, error) {
+	templateRepositories, err := getTemplateRepositories()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []cachedRelease
+	for _, templateRepository := range templateRepositories {
+		releases, err := listCachedReleases(templateRepository)
+		if err != nil {
+			return nil, err
+		}
+
+		locked := ""
+		if lock != nil {
+			if template, ok := lock.template(templateRepository.Name); ok {
+				locked = template.Tag
+			}
+		}
+
+		kept := 0
+		for _, release := range releases {
+			if kept < keep || release.Latest || release.Tag == locked {
+				kept++
+				continue
+			}
+			if err := removeCachedRelease(release); err != nil {
+				return nil, fmt.Errorf("template '%s': %w", templateRepository.Name, err)
+			}
+			removed = append(removed, release)
+		}
+	}
+
+	return removed, nil
+}
+
+// verifyCachedRelease re-hashes a cached release against its record and the lock, it returns the problems found
+// and whether the release could be verified at all
+func verifyCachedRelease(templateRepository BaseTemplateRepository, release cachedRelease, lock *LockFile) ([]string, bool, error) {
+	record, err := readReleaseRecord(templateRepository, release.Tag)
+	if err != nil {
+		return nil, false, err
+	}
+	if record == nil {
+		return nil, false, nil
+	}
+
+	var problems []string
+	if digest, err := fileDigest(release.Directory + ".tar.gz"); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, false, ioError(err)
+		}
+		problems = append(problems, "tarball is missing")
+	} else if digest != record.Digest {
+		problems = append(problems, fmt.Sprintf("tarball digest '%s' does not match the recorded digest '%s'", digest, record.Digest))
+	}
+
+	digest, err := treeDigest(release.Directory)
+	if err != nil {
+		return nil, false, ioError(err)
+	}
+	if digest != record.TreeDigest {
+		problems = append(problems, "extracted files were changed since the release was downloaded")
+	}
+
+	if lock != nil {
+		if locked, ok := lock.template(templateRepository.Name); ok && locked.Tag == release.Tag && locked.Digest != record.Digest {
+			problems = append(problems, fmt.Sprintf("recorded digest '%s' does not match the locked digest '%s'", record.Digest, locked.Digest))
+		}
+	}
+
+	return problems, true, nil
+}
@@ -0,0 +1,594 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// version is the cli version, override at build time using -ldflags "-X main.version=..."
+var version = "dev"
+
+var errUsage = errors.New("usage")
+
+type command struct {
+	Name        string
+	Description string
+	Run         func(args []string) error
+	Commands    []command
+}
+
+var commands = []command{
+	{
+		Name:        "build",
+		Description: "generate the api, logic and portal projects for a schema",
+		Run:         runBuild,
+	},
+	{
+		Name:        "cache",
+		Description: "manage the base template cache",
+		Commands: []command{
+			{
+				Name:        "update",
+				Description: "download the latest release of each base template",
+				Run:         runCacheUpdate,
+			},
+			{
+				Name:        "list",
+				Description: "list the cached releases of each base template",
+				Run:         runCacheList,
+			},
+			{
+				Name:        "prune",
+				Description: "remove all but the newest cached releases",
+				Run:         runCachePrune,
+			},
+			{
+				Name:        "verify",
+				Description: "re-hash the cached releases against their recorded digests",
+				Run:         runCacheVerify,
+			},
+			{
+				Name:        "clear",
+				Description: "remove the cached releases",
+				Run:         runCacheClear,
+			},
+			{
+				Name:        "upgrade",
+				Description: "move the releases pinned in fluid.lock to the latest release",
+				Run:         runCacheUpgrade,
+			},
+		},
+	},
+	{
+		Name:        "validate",
+		Description: "validate a schema without generating anything",
+		Run:         runValidate,
+	},
+	{
+		Name:        "lint",
+		Description: "check a schema against opinionated lint rules",
+		Run:         runLint,
+	},
+	{
+		Name:        "version",
+		Description: "print the cli version",
+		Run:         runVersion,
+	},
+}
+
+var run = func(args []string) error {
+	return dispatch("fluid", commands, args)
+}
+
+func dispatch(prefix string, commands []command, args []string) error {
+	if len(args) <= 0 {
+		printUsage(os.Stderr, prefix, commands)
+		return errUsage
+	}
+
+	if args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		printUsage(os.Stdout, prefix, commands)
+		return nil
+	}
+
+	for _, c := range commands {
+		if c.Name != args[0] {
+			continue
+		}
+		if len(c.Commands) > 0 {
+			return dispatch(fmt.Sprintf("%s %s", prefix, c.Name), c.Commands, args[1:])
+		}
+		return c.Run(args[1:])
+	}
+
+	printUsage(os.Stderr, prefix, commands)
+	return usageError(fmt.Errorf("unknown command '%s %s'", prefix, args[0]))
+}
+
+func printUsage(w io.Writer, prefix string, commands []command) {
+	_, _ = fmt.Fprintf(w, "Usage:\n  %s <command> [flags]\n\nCommands:\n", prefix)
+	for _, c := range commands {
+		_, _ = fmt.Fprintf(w, "  %-12s %s\n", c.Name, c.Description)
+	}
+	_, _ = fmt.Fprintf(w, "\nRun '%s <command> -h' for more information on a command.\n", prefix)
+}
+
+func newFlagSet(name, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(flags.Output(), "Usage:\n  fluid %s\n\nFlags:\n", usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags returns flag.ErrHelp when help was requested, which the caller treats as success
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return errUsage
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func defaultOutputDirectory() string {
+	homeDirectory, err := os.UserHomeDir()
+
+	if err != nil {
+		return "."
+	}
+
+	return filepath.Join(homeDirectory, "Downloads")
+}
+
+var runBuild = func(args []string) error {
+	flags := newFlagSet("build", "build [flags]")
+	schemaPath := flags.String("schema", "", "path to the project schema, or - to read from stdin (defaults to the built-in fluid project scheme)")
+	schemaFormat := flags.String("format", "", "schema format: json, yaml or toml (defaults to the schema file extension, json for stdin)")
+	outputDirectory := flags.String("output", defaultOutputDirectory(), "directory the generated project is written to")
+	archiveOutput := flags.Bool("archive", false, "write the generated project as a .tar.gz archive instead of a directory")
+	skipCacheUpdate := flags.Bool("skip-cache-update", false, "build from the cached base templates without checking for new releases")
+	dryRun := flags.Bool("dry-run", false, "list the files that would be created, modified or deleted without writing the output")
+	showDiff := flags.Bool("diff", false, "print unified diffs of the output directory against the generated files without writing the output")
+	lockPath := flags.String("lock", "", "path to the lock file pinning the base template releases (defaults to fluid.lock next to the schema)")
+	offline := flags.Bool("offline", false, "build from the template cache without network access, fails when a template is not cached")
+	embeddedTemplates := flags.Bool("embedded-templates", false, "with -offline, use the minimal embedded templates for templates that are neither locked nor cached")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *archiveOutput && (*dryRun || *showDiff) {
+		return usageError(errors.New("-archive cannot be combined with -dry-run or -diff"))
+	}
+	if *embeddedTemplates && !*offline {
+		return usageError(errors.New("-embedded-templates requires -offline"))
+	}
+
+	document, err := loadSchema(*schemaPath, *schemaFormat)
+	if err != nil {
+		return err
+	}
+
+	if diagnostics := validateDocument(document); len(diagnostics) > 0 {
+		_ = printDiagnostics(os.Stderr, diagnostics, false)
+		return validationError(fmt.Errorf("schema '%s' has %d validation error(s)", document.Project.Name, len(diagnostics)))
+	}
+
+	if *lockPath == "" {
+		*lockPath = defaultLockPath(*schemaPath)
+	}
+	lock, err := readLockFile(*lockPath)
+	if err != nil {
+		return err
+	}
+
+	var templates map[string]string
+	switch {
+	case *offline:
+		embeddedDirectory := ""
+		if *embeddedTemplates {
+			if embeddedDirectory, err = ioutil.TempDir("", "*"); err != nil {
+				return ioError(err)
+			}
+			defer func() { _ = os.RemoveAll(embeddedDirectory) }()
+		}
+		if templates, err = offlineTemplateDirectories(lock, embeddedDirectory); err != nil {
+			return err
+		}
+	case lock != nil:
+		if templates, err = lockedTemplateDirectories(*lock, !*skipCacheUpdate); err != nil {
+			return err
+		}
+	case !*skipCacheUpdate:
+		releases, err := updateCaches()
+		if err != nil {
+			return fmt.Errorf("update cache: %w", err)
+		}
+		if !*dryRun && !*showDiff {
+			if err := writeLockFile(*lockPath, LockFile{Templates: releases}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return buildProject(document.Project, document.Extensions, *outputDirectory, BuildOptions{
+		Archive:   *archiveOutput,
+		DryRun:    *dryRun,
+		Diff:      *showDiff,
+		Templates: templates,
+	})
+}
+
+var runCacheUpdate = func(args []string) error {
+	flags := newFlagSet("cache update", "cache update")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	_, err := updateCaches()
+	return err
+}
+
+var runCacheList = func(args []string) error {
+	flags := newFlagSet("cache list", "cache list")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	templateRepositories, err := getTemplateRepositories()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-16s %-16s %10s %s\n", "TEMPLATE", "TAG", "SIZE", "LATEST")
+	for _, templateRepository := range templateRepositories {
+		releases, err := listCachedReleases(templateRepository)
+		if err != nil {
+			return err
+		}
+		for _, release := range releases {
+			latest := ""
+			if release.Latest {
+				latest = "*"
+			}
+			fmt.Println(strings.TrimSpace(fmt.Sprintf("%-16s %-16s %10s %s", release.Template, release.Tag, formatSize(release.Size), latest)))
+		}
+	}
+	return nil
+}
+
+var runCachePrune = func(args []string) error {
+	flags := newFlagSet("cache prune", "cache prune [flags]")
+	keep := flags.Int("keep", 1, "number of releases to keep per template, the latest and locked releases are always kept")
+	schemaPath := flags.String("schema", "", "path to the project schema the lock file sits next to")
+	lockPath := flags.String("lock", "", "lock file whose pinned releases are kept (defaults to fluid.lock next to the schema)")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *lockPath == "" {
+		*lockPath = defaultLockPath(*schemaPath)
+	}
+
+	if *keep < 0 {
+		return usageError(errors.New("-keep may not be negative"))
+	}
+
+	lock, err := readLockFile(*lockPath)
+	if err != nil {
+		return err
+	}
+
+	removed, err := pruneCache(*keep, lock)
+	if err != nil {
+		return err
+	}
+
+	templateRepositories, err := getTemplateRepositories()
+	if err != nil {
+		return err
+	}
+	var releaseInfos []string
+	for _, templateRepository := range templateRepositories {
+		releaseInfos = append(releaseInfos, templateRepository.LatestReleaseInfo)
+	}
+	responses, freed, err := pruneHttpCache(releaseInfos)
+	if err != nil {
+		return err
+	}
+
+	for _, release := range removed {
+		freed += release.Size
+		fmt.Printf("removed %s %s (%s)\n", release.Template, release.Tag, formatSize(release.Size))
+	}
+	if responses > 0 {
+		fmt.Printf("removed %d stale cached response(s)\n", responses)
+	}
+	fmt.Printf("%d release(s) removed, %s freed\n", len(removed), formatSize(freed))
+	return nil
+}
+
+var runCacheVerify = func(args []string) error {
+	flags := newFlagSet("cache verify", "cache verify [flags]")
+	schemaPath := flags.String("schema", "", "path to the project schema the lock file sits next to")
+	lockPath := flags.String("lock", "", "lock file whose digests the cached releases are also checked against (defaults to fluid.lock next to the schema)")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *lockPath == "" {
+		*lockPath = defaultLockPath(*schemaPath)
+	}
+
+	lock, err := readLockFile(*lockPath)
+	if err != nil {
+		return err
+	}
+
+	templateRepositories, err := getTemplateRepositories()
+	if err != nil {
+		return err
+	}
+
+	failures := 0
+	for _, templateRepository := range templateRepositories {
+		latest := filepath.Join(templateRepository.CacheDirectory, "latest")
+		if _, err := os.Lstat(latest); err == nil {
+			if _, err := os.Stat(latest); err != nil {
+				failures++
+				fmt.Printf("FAIL       %s latest: points to a release that is not cached\n", templateRepository.Name)
+			}
+		}
+
+		releases, err := listCachedReleases(templateRepository)
+		if err != nil {
+			return err
+		}
+		for _, release := range releases {
+			problems, verified, err := verifyCachedRelease(templateRepository, release, lock)
+			if err != nil {
+				return fmt.Errorf("template '%s': %w", templateRepository.Name, err)
+			}
+			switch {
+			case !verified:
+				fmt.Printf("UNVERIFIED %s %s: no digest was recorded when the release was cached\n", release.Template, release.Tag)
+			case len(problems) > 0:
+				failures++
+				for _, problem := range problems {
+					fmt.Printf("FAIL       %s %s: %s\n", release.Template, release.Tag, problem)
+				}
+			default:
+				fmt.Printf("OK         %s %s\n", release.Template, release.Tag)
+			}
+		}
+	}
+
+	if failures > 0 {
+		return cacheError(fmt.Errorf("%d cached release(s) failed verification, remove them with 'fluid cache clear' and download them again", failures))
+	}
+	return nil
+}
+
+var runCacheClear = func(args []string) error {
+	flags := newFlagSet("cache clear", "cache clear [flags]")
+	templates := flags.String("template", "", "comma separated templates to clear (defaults to all templates)")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	templateRepositories, err := getTemplateRepositories()
+	if err != nil {
+		return err
+	}
+
+	templateRepositories, err = selectTemplateRepositories(templateRepositories, splitList(*templates))
+	if err != nil {
+		return err
+	}
+
+	var releaseInfos []string
+	for _, templateRepository := range templateRepositories {
+		if err := os.RemoveAll(templateRepository.CacheDirectory); err != nil {
+			return ioError(err)
+		}
+		releaseInfos = append(releaseInfos, templateRepository.LatestReleaseInfo)
+		fmt.Printf("cleared %s\n", templateRepository.Name)
+	}
+
+	// the cached release info goes with the releases, all of it when no templates were named
+	if *templates == "" {
+		releaseInfos = nil
+	}
+	return removeHttpCache(releaseInfos)
+}
+
+var runCacheUpgrade = func(args []string) error {
+	flags := newFlagSet("cache upgrade", "cache upgrade [flags]")
+	schemaPath := flags.String("schema", "", "path to the project schema the lock file sits next to")
+	lockPath := flags.String("lock", "", "path to the lock file to upgrade, it is created when missing (defaults to fluid.lock next to the schema)")
+	templates := flags.String("template", "", "comma separated templates to upgrade (defaults to all templates)")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *lockPath == "" {
+		*lockPath = defaultLockPath(*schemaPath)
+	}
+
+	lock, err := readLockFile(*lockPath)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		lock = &LockFile{}
+	}
+
+	report, err := upgradeLock(lock, splitList(*templates))
+	if err != nil {
+		return err
+	}
+
+	if err := writeLockFile(*lockPath, *lock); err != nil {
+		return err
+	}
+
+	for _, line := range report {
+		fmt.Println(line)
+	}
+	return nil
+}
+
+var runValidate = func(args []string) error {
+	flags := newFlagSet("validate", "validate [flags]")
+	schemaPath := flags.String("schema", "", "path to the project schema, or - to read from stdin (defaults to the built-in fluid project scheme)")
+	schemaFormat := flags.String("format", "", "schema format: json, yaml or toml (defaults to the schema file extension, json for stdin)")
+	asJson := flags.Bool("json", false, "print diagnostics as a json array")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	document, err := loadSchema(*schemaPath, *schemaFormat)
+	if err != nil {
+		if diagnostic, ok := schemaErrorDiagnostic(err); ok && *asJson {
+			_ = printDiagnostics(os.Stdout, []Diagnostic{diagnostic}, true)
+		}
+		return err
+	}
+
+	diagnostics := validateDocument(document)
+	if err := printDiagnostics(os.Stdout, diagnostics, *asJson); err != nil {
+		return ioError(err)
+	}
+
+	if count := countSeverity(diagnostics, SeverityError); count > 0 {
+		return validationError(fmt.Errorf("schema '%s' has %d validation error(s)", document.Project.Name, count))
+	}
+
+	if !*asJson {
+		fmt.Printf("schema '%s' is valid\n", document.Project.Name)
+	}
+	return nil
+}
+
+var runLint = func(args []string) error {
+	flags := newFlagSet("lint", "lint [flags]")
+	schemaPath := flags.String("schema", "", "path to the project schema, or - to read from stdin (defaults to the built-in fluid project scheme)")
+	schemaFormat := flags.String("format", "", "schema format: json, yaml or toml (defaults to the schema file extension, json for stdin)")
+	configPath := flags.String("config", "", "path to a lint config (json, yaml or toml) setting rule severities to off, info, warning or error")
+	enable := flags.String("enable", "", "comma separated rules to enable with their default severity")
+	disable := flags.String("disable", "", "comma separated rules to disable")
+	asJson := flags.Bool("json", false, "print diagnostics as a json array")
+	list := flags.Bool("list", false, "list the available rules and exit")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *list {
+		for _, rule := range lintRules {
+			fmt.Printf("%-24s %-8s %s\n", rule.Name, rule.Severity, rule.Description)
+		}
+		return nil
+	}
+
+	config, err := loadLintConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range splitList(*enable) {
+		rule, ok := findLintRule(name)
+		if !ok {
+			return usageError(fmt.Errorf("lint rule '%s' does not exist", name))
+		}
+		config.Rules[name] = rule.Severity
+	}
+
+	for _, name := range splitList(*disable) {
+		if _, ok := findLintRule(name); !ok {
+			return usageError(fmt.Errorf("lint rule '%s' does not exist", name))
+		}
+		config.Rules[name] = SeverityOff
+	}
+
+	document, err := loadSchema(*schemaPath, *schemaFormat)
+	if err != nil {
+		if diagnostic, ok := schemaErrorDiagnostic(err); ok && *asJson {
+			_ = printDiagnostics(os.Stdout, []Diagnostic{diagnostic}, true)
+		}
+		return err
+	}
+
+	diagnostics := append(validateDocument(document), lintDocument(document, config)...)
+	if err := printDiagnostics(os.Stdout, diagnostics, *asJson); err != nil {
+		return ioError(err)
+	}
+
+	if count := countSeverity(diagnostics, SeverityError); count > 0 {
+		return validationError(fmt.Errorf("schema '%s' has %d lint error(s)", document.Project.Name, count))
+	}
+
+	if !*asJson && len(diagnostics) <= 0 {
+		fmt.Printf("schema '%s' has no lint problems\n", document.Project.Name)
+	}
+	return nil
+}
+
+var loadLintConfig = func(path string) (LintConfig, error) {
+	config := LintConfig{Rules: map[string]string{}}
+	if strings.TrimSpace(path) == "" {
+		return config, nil
+	}
+
+	format, err := schemaFormat(path, "")
+	if err != nil {
+		return config, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, ioError(err)
+	}
+
+	if err := decodeSchema(path, format, data, &config); err != nil {
+		return config, err
+	}
+
+	if config.Rules == nil {
+		config.Rules = map[string]string{}
+	}
+
+	if err := config.validate(); err != nil {
+		return config, validationError(fmt.Errorf("%s: %w", path, err))
+	}
+
+	return config, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+var runVersion = func(args []string) error {
+	flags := newFlagSet("version", "version")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	fmt.Printf("fluid %s\n", version)
+	return nil
+}
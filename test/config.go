@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// configEnvironmentVariable overrides the path of the cli config
+const configEnvironmentVariable = "FLUID_CONFIG"
+
+const (
+	TemplateSourceGithub    = "github"    // a github style releases endpoint, the default
+	TemplateSourceTarball   = "tarball"   // a single tarball url
+	TemplateSourceDirectory = "directory" // a local directory used as is
+	TemplateSourceGit       = "git"       // a local git repository at a ref
+)
+
+// defaultGithubApiUrl is the base url of the github api serving the default template releases
+const defaultGithubApiUrl = "https://api.github.com"
+
+// TemplateSource tells where a base template is fetched from, relative paths are relative to the config file
+type TemplateSource struct {
+	Type       string `json:"type,omitempty"`
+	BaseUrl    string `json:"baseUrl,omitempty"`    // github: api base url, defaults to https://api.github.com
+	Repository string `json:"repository,omitempty"` // github: owner/name of the repository publishing the releases
+	Url        string `json:"url,omitempty"`        // tarball: http(s) or file url of the tarball
+	Tag        string `json:"tag,omitempty"`        // tarball: tag the tarball is cached and locked under, defaults to the url file name
+	Path       string `json:"path,omitempty"`       // directory and git: local path
+	Ref        string `json:"ref,omitempty"`        // git: branch, tag or commit, defaults to HEAD
+}
+
+// Config is the cli config, read from $FLUID_CONFIG or fluid/config.{json,yaml,yml,toml} in the user config directory
+type Config struct {
+	Templates map[string]TemplateSource `json:"templates,omitempty"`
+	Http      HttpConfig                `json:"http,omitempty"`
+}
+
+func (c Config) validate(templateNames []string) error {
+	if err := c.Http.validate(); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(c.Templates))
+	for name := range c.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !containsName(templateNames, name) {
+			return fmt.Errorf("template '%s' does not exist, expected one of: %s", name, strings.Join(templateNames, ", "))
+		}
+
+		source := c.Templates[name]
+		var err error
+		switch source.Type {
+		case "", TemplateSourceGithub:
+			if source.BaseUrl != "" && !strings.HasPrefix(source.BaseUrl, "http://") && !strings.HasPrefix(source.BaseUrl, "https://") {
+				err = fmt.Errorf("base url '%s' must be an http or https url", source.BaseUrl)
+			}
+		case TemplateSourceTarball:
+			if !strings.HasPrefix(source.Url, "http://") && !strings.HasPrefix(source.Url, "https://") && !strings.HasPrefix(source.Url, "file://") {
+				err = fmt.Errorf("url '%s' must be an http, https or file url", source.Url)
+			}
+		case TemplateSourceDirectory, TemplateSourceGit:
+			if strings.TrimSpace(source.Path) == "" {
+				err = fmt.Errorf("a %s source needs a path", source.Type)
+			}
+		default:
+			err = fmt.Errorf("source type '%s' is not supported, expected one of: github, tarball, directory, git", source.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("template '%s': %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// configPath returns the config file to read, an empty path when there is none
+func configPath() string {
+	if path := os.Getenv(configEnvironmentVariable); path != "" {
+		return path
+	}
+
+	configDirectory, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	for _, name := range []string{"config.json", "config.yaml", "config.yml", "config.toml"} {
+		path := filepath.Join(configDirectory, "fluid", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadConfig reads the cli config, a missing config is an empty one
+var loadConfig = func() (Config, error) {
+	config := Config{}
+
+	path := configPath()
+	if path == "" {
+		return config, nil
+	}
+
+	format, err := schemaFormat(path, "")
+	if err != nil {
+		return config, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, ioError(err)
+	}
+
+	if err := decodeSchema(path, format, data, &config); err != nil {
+		return config, err
+	}
+
+	if err := config.validate(templateNames); err != nil {
+		return config, validationError(fmt.Errorf("%s: %w", path, err))
+	}
+
+	// local paths are relative to the config so the same config works from any working directory
+	configDirectory, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return config, ioError(err)
+	}
+	for name, source := range config.Templates {
+		if source.Path != "" && !filepath.IsAbs(source.Path) {
+			source.Path = filepath.Join(configDirectory, source.Path)
+			config.Templates[name] = source
+		}
+	}
+
+	return config, nil
+}
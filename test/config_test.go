@@ -0,0 +1,170 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupTestEnvironment points the cache and the cli config at a temporary home and records sleeps instead of sleeping
+func setupTestEnvironment(t *testing.T, config string) (string, *[]time.Duration) {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv(fluidTokenEnvironmentVariable, "")
+	t.Setenv(githubTokenEnvironmentVariable, "")
+
+	configFile := filepath.Join(home, "config.yaml")
+	if err := ioutil.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(configEnvironmentVariable, configFile)
+
+	var sleeps []time.Duration
+	originalSleep := sleep
+	sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	t.Cleanup(func() { sleep = originalSleep })
+
+	return home, &sleeps
+}
+
+// testTarball builds a release tarball with every file below a single top level directory, like github tarballs
+func testTarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		header := &tar.Header{Name: "release/" + name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func testDigest(data []byte) string {
+	hash := sha256.Sum256(data)
+	return digestPrefix + hex.EncodeToString(hash[:])
+}
+
+func testTemplateRepository(t *testing.T, name string) BaseTemplateRepository {
+	t.Helper()
+
+	templateRepositories, err := getTemplateRepositories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, templateRepository := range templateRepositories {
+		if templateRepository.Name == name {
+			return templateRepository
+		}
+	}
+	t.Fatalf("template '%s' does not exist", name)
+	return BaseTemplateRepository{}
+}
+
+func TestGithubSourceFromHttpStub(t *testing.T) {
+	tarball := testTarball(t, map[string]string{"go.mod": "module api\n"})
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/acme/base-api/releases/latest":
+			_, _ = fmt.Fprintf(w, `{"tag_name": "v1.2.0", "tarball_url": "%s/tarballs/v1.2.0"}`, server.URL)
+		case "/tarballs/v1.2.0":
+			_, _ = w.Write(tarball)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	home, _ := setupTestEnvironment(t, fmt.Sprintf("templates:\n  api:\n    baseUrl: %s\n    repository: acme/base-api\n", server.URL))
+
+	release, err := updateCache(testTemplateRepository(t, "api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if release.Tag != "v1.2.0" || release.TarballUrl != server.URL+"/tarballs/v1.2.0" || release.Digest != testDigest(tarball) {
+		t.Errorf("unexpected release %+v", release)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(home, ".cache", "fluid", "api", "latest", "go.mod"))
+	if err != nil || string(data) != "module api\n" {
+		t.Errorf("release was not extracted to latest: %q, %v", data, err)
+	}
+}
+
+func TestTarballSourceFromHttpStub(t *testing.T) {
+	tarball := testTarball(t, map[string]string{"package.json": "{}\n"})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/base-portal-v2.0.0.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(tarball)
+	}))
+	defer server.Close()
+
+	home, _ := setupTestEnvironment(t, fmt.Sprintf("templates:\n  portal-ionic:\n    type: tarball\n    url: %s/base-portal-v2.0.0.tar.gz\n", server.URL))
+
+	release, err := updateCache(testTemplateRepository(t, "portal-ionic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if release.Tag != "base-portal-v2.0.0" || release.Digest != testDigest(tarball) {
+		t.Errorf("unexpected release %+v", release)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".cache", "fluid", "portal-ionic", "base-portal-v2.0.0", "package.json")); err != nil {
+		t.Errorf("release was not extracted: %v", err)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		error  string
+	}{
+		{"unknown template", "templates:\n  mobile: {}\n", "template 'mobile' does not exist"},
+		{"unknown source type", "templates:\n  api: {type: svn}\n", "source type 'svn' is not supported"},
+		{"directory without path", "templates:\n  api: {type: directory}\n", "a directory source needs a path"},
+		{"ftp tarball", "templates:\n  api: {type: tarball, url: 'ftp://example.com/a.tar.gz'}\n", "must be an http, https or file url"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupTestEnvironment(t, test.config)
+			_, err := loadConfig()
+			if err == nil || !strings.Contains(err.Error(), test.error) || exitCode(err) != ExitCodeValidation {
+				t.Errorf("expected a validation error containing %q, got %v", test.error, err)
+			}
+		})
+	}
+}
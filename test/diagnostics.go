@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-fluid/fluid"
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Diagnostic is a single problem found in a schema, located by a json pointer into the composed project
+type Diagnostic struct {
+	Path     string `json:"path"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Rule     string `json:"rule,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+}
+
+func (d Diagnostic) String() string {
+	location := ""
+	if d.File != "" {
+		location = d.File + ":"
+		if d.Line > 0 {
+			location += fmt.Sprintf("%d:%d:", d.Line, d.Column)
+		}
+		location += " "
+	}
+	path := d.Path
+	if path == "" {
+		path = "/"
+	}
+	if d.Rule != "" {
+		return fmt.Sprintf("%s%s: %s: %s [%s]", location, d.Severity, path, d.Message, d.Rule)
+	}
+	return fmt.Sprintf("%s%s: %s: %s", location, d.Severity, path, d.Message)
+}
+
+// allowedValues lists the values accepted by each of the custom fluid validation tags
+var allowedValues = map[string][]string{
+	"portalType": {
+		fluid.PortalTypeIonic,
+		fluid.PortalTypeVuetify,
+	},
+	"entityFieldType": {
+		fluid.EntityFieldTypeString,
+		fluid.EntityFieldTypeInteger,
+		fluid.EntityFieldTypeDecimal,
+		fluid.EntityFieldTypeDateTime,
+		fluid.EntityFieldTypeDate,
+		fluid.EntityFieldTypeTime,
+		fluid.EntityFieldTypeBoolean,
+		fluid.EntityFieldTypeMoney,
+		fluid.EntityFieldTypeUuid,
+		fluid.EntityFieldTypeAttribute,
+		fluid.EntityFieldTypeBinary,
+		fluid.EntityFieldTypePassword,
+	},
+	"entityActionMethod": {
+		fluid.EntityActionMethodGet,
+		fluid.EntityActionMethodPost,
+		fluid.EntityActionMethodPut,
+		fluid.EntityActionMethodDelete,
+	},
+	"entityActionType": {
+		fluid.EntityActionTypeList,
+		fluid.EntityActionTypeRecord,
+	},
+	"contractType": {
+		fluid.ContractTypeRequest,
+		fluid.ContractTypeResponse,
+		fluid.ContractTypeParameters,
+	},
+	"contractFieldType": {
+		fluid.ContractFieldTypeString,
+		fluid.ContractFieldTypeInteger,
+		fluid.ContractFieldTypeDecimal,
+		fluid.ContractFieldTypeDateTime,
+		fluid.ContractFieldTypeDate,
+		fluid.ContractFieldTypeTime,
+		fluid.ContractFieldTypeBoolean,
+		fluid.ContractFieldTypeMoney,
+		fluid.ContractFieldTypeUuid,
+		fluid.ContractFieldTypeBinary,
+		fluid.ContractFieldTypeFile,
+	},
+}
+
+var validateDocument = func(document *SchemaDocument) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for _, fieldError := range validateProject(document.Project) {
+		diagnostics = append(diagnostics, document.locate(Diagnostic{
+			Path:     namespaceToPointer(fieldError.Namespace()),
+			Severity: SeverityError,
+			Message:  fieldErrorMessage(fieldError),
+		}))
+	}
+
+	projectDiagnostics := append(validateFieldOptions(document.Project), validateEntityActions(document.Project)...)
+	for _, diagnostic := range append(projectDiagnostics, validateExtensions(document.Project, document.Extensions)...) {
+		diagnostics = append(diagnostics, document.locate(diagnostic))
+	}
+
+	return diagnostics
+}
+
+// validateProject validates a copy of the project without field options, fluid tags option values with a validation it never
+// registers and panics on any field with options so those are checked by validateFieldOptions instead
+func validateProject(project fluid.Project) validator.ValidationErrors {
+	entities := make([]fluid.Entity, len(project.Entities))
+	for i, entity := range project.Entities {
+		fields := make([]fluid.EntityField, len(entity.Fields))
+		for j, field := range entity.Fields {
+			field.Options = nil
+			fields[j] = field
+		}
+		entity.Fields = fields
+		entities[i] = entity
+	}
+	project.Entities = entities
+	return project.Validate()
+}
+
+// validateFieldOptions checks option values against the field type, only string and integer fields support options
+func validateFieldOptions(project fluid.Project) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for i, entity := range project.Entities {
+		for j, field := range entity.Fields {
+			if len(field.Options) <= 0 {
+				continue
+			}
+			pointer := fmt.Sprintf("/entities/%d/fields/%d/options", i, j)
+
+			fieldType := strings.ToLower(field.Type)
+			if fieldType != fluid.EntityFieldTypeString && fieldType != fluid.EntityFieldTypeInteger {
+				diagnostics = append(diagnostics, Diagnostic{
+					Path:     pointer,
+					Severity: SeverityError,
+					Message:  fmt.Sprintf("options are only available for string and integer fields, not '%s'", field.Type),
+				})
+				continue
+			}
+
+			for k, option := range field.Options {
+				if strings.TrimSpace(option.Text) == "" {
+					diagnostics = append(diagnostics, Diagnostic{
+						Path:     fmt.Sprintf("%s/%d/text", pointer, k),
+						Severity: SeverityError,
+						Message:  "is required",
+					})
+				}
+				if !isOptionValue(fieldType, option.Value) {
+					diagnostics = append(diagnostics, Diagnostic{
+						Path:     fmt.Sprintf("%s/%d/value", pointer, k),
+						Severity: SeverityError,
+						Message:  fmt.Sprintf("'%v' is not a valid %s option value", option.Value, fieldType),
+					})
+				}
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+func isOptionValue(fieldType string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return fieldType == fluid.EntityFieldTypeString && v != ""
+	case int, int64:
+		return fieldType == fluid.EntityFieldTypeInteger
+	case float64:
+		return fieldType == fluid.EntityFieldTypeInteger && v == math.Trunc(v)
+	}
+	return false
+}
+
+func fieldErrorMessage(fieldError validator.FieldError) string {
+	if fieldError.Tag() == "required" {
+		return "is required"
+	}
+
+	if values, ok := allowedValues[fieldError.Tag()]; ok {
+		return fmt.Sprintf("'%v' is not a valid %s, expected one of: %s", fieldError.Value(), strings.ToLower(titleCase(fieldError.Tag())), strings.Join(values, ", "))
+	}
+
+	if fieldError.Tag() == "color" {
+		return fmt.Sprintf("'%v' is not a valid hex color", fieldError.Value())
+	}
+
+	return fmt.Sprintf("'%v' failed on the '%s' validation", fieldError.Value(), fieldError.Tag())
+}
+
+var namespaceSegmentPattern = regexp.MustCompile(`^([^\[]+)((?:\[\d+\])*)$`)
+var namespaceIndexPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// namespaceToPointer converts a validator namespace such as 'Project.Entities[1].Fields[0].Type' into a json pointer such as '/entities/1/fields/0/type'
+func namespaceToPointer(namespace string) string {
+	segments := strings.Split(namespace, ".")
+	if len(segments) <= 1 {
+		return ""
+	}
+
+	pointer := ""
+	current := reflect.TypeOf(fluid.Project{})
+	for _, segment := range segments[1:] {
+		matches := namespaceSegmentPattern.FindStringSubmatch(segment)
+		if matches == nil {
+			pointer += "/" + segment
+			current = nil
+			continue
+		}
+
+		name := matches[1]
+		if current != nil {
+			if field, ok := current.FieldByName(name); ok {
+				if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+					name = tag
+				}
+				current = field.Type
+			} else {
+				current = nil
+			}
+		}
+		pointer += "/" + name
+
+		for _, index := range namespaceIndexPattern.FindAllStringSubmatch(matches[2], -1) {
+			pointer += "/" + index[1]
+			if current != nil && (current.Kind() == reflect.Slice || current.Kind() == reflect.Array) {
+				current = current.Elem()
+			}
+		}
+
+		for current != nil && current.Kind() == reflect.Ptr {
+			current = current.Elem()
+		}
+		if current != nil && current.Kind() != reflect.Struct {
+			current = nil
+		}
+	}
+
+	return pointer
+}
+
+// schemaErrorDiagnostic converts a schema decoding error into a diagnostic so it can be reported alongside validation problems
+func schemaErrorDiagnostic(err error) (Diagnostic, bool) {
+	var schemaError *SchemaError
+	if !errors.As(err, &schemaError) {
+		return Diagnostic{}, false
+	}
+
+	path := ""
+	for _, key := range schemaError.key {
+		path += "/" + key
+	}
+
+	return Diagnostic{
+		Path:     path,
+		Severity: SeverityError,
+		Message:  schemaError.Err.Error(),
+		File:     schemaError.Path,
+		Line:     schemaError.Line,
+		Column:   schemaError.Column,
+	}, true
+}
+
+// locate fills in the file, line and column of a diagnostic from the files the document was composed from
+func (d *SchemaDocument) locate(diagnostic Diagnostic) Diagnostic {
+	file := d.root
+	pointer := diagnostic.Path
+
+	segments := strings.SplitN(strings.TrimPrefix(pointer, "/"), "/", 3)
+	if len(segments) >= 2 {
+		if origin, ok := d.origins[fmt.Sprintf("/%s/%s", segments[0], segments[1])]; ok {
+			file = origin.File
+			pointer = origin.Pointer
+			if len(segments) == 3 {
+				pointer += "/" + segments[2]
+			}
+		}
+	}
+
+	if file.Path == "" {
+		return diagnostic
+	}
+
+	diagnostic.File = file.Path
+	if node := findPointerNode(file, pointer); node != nil {
+		diagnostic.Line = node.Line
+		diagnostic.Column = node.Column
+	}
+	return diagnostic
+}
+
+// findPointerNode returns the node closest to the json pointer, json is parsed as yaml (a superset) to obtain node positions
+func findPointerNode(file schemaFile, pointer string) *yaml.Node {
+	if file.Format != SchemaFormatJson && file.Format != SchemaFormatYaml {
+		return nil
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(file.Data, &document); err != nil || len(document.Content) <= 0 {
+		return nil
+	}
+
+	node := document.Content[0]
+	if pointer == "" {
+		return node
+	}
+
+	for _, segment := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		switch node.Kind {
+		case yaml.MappingNode:
+			found := false
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == segment {
+					if node.Content[i+1].Kind == yaml.ScalarNode {
+						return node.Content[i]
+					}
+					node = node.Content[i+1]
+					found = true
+					break
+				}
+			}
+			if !found {
+				return node
+			}
+		case yaml.SequenceNode:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node.Content) {
+				return node
+			}
+			node = node.Content[index]
+		default:
+			return node
+		}
+	}
+
+	return node
+}
+
+func printDiagnostics(w io.Writer, diagnostics []Diagnostic, asJson bool) error {
+	if asJson {
+		if diagnostics == nil {
+			diagnostics = []Diagnostic{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diagnostics)
+	}
+
+	for _, diagnostic := range diagnostics {
+		if _, err := fmt.Fprintln(w, diagnostic.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func countSeverity(diagnostics []Diagnostic, severity string) int {
+	count := 0
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
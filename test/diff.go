@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// diffContextLines is the number of unchanged lines shown around every change of a unified diff
+const diffContextLines = 3
+
+// diffEdit is a single line of a diff, Kind is ' ' for unchanged, '-' for removed and '+' for added lines
+type diffEdit struct {
+	Kind byte
+	Line string
+}
+
+func diffEdits(a, b []string) []diffEdit {
+	var edits []diffEdit
+	i, j := 0, 0
+	for _, match := range append(diffMatches(a, b), [2]int{len(a), len(b)}) {
+		for ; i < match[0]; i++ {
+			edits = append(edits, diffEdit{Kind: '-', Line: a[i]})
+		}
+		for ; j < match[1]; j++ {
+			edits = append(edits, diffEdit{Kind: '+', Line: b[j]})
+		}
+		if i < len(a) && j < len(b) {
+			edits = append(edits, diffEdit{Kind: ' ', Line: a[i]})
+			i, j = i+1, j+1
+		}
+	}
+	return edits
+}
+
+// hunkRange formats the start and length of a hunk side, an empty side starts at the line before it
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// writeUnifiedDiff writes the difference between two versions of a file in unified diff format, nil content stands for a missing file
+func writeUnifiedDiff(w io.Writer, path string, from, to []byte) error {
+	fromName, toName := "a/"+path, "b/"+path
+	if from == nil {
+		fromName = "/dev/null"
+	}
+	if to == nil {
+		toName = "/dev/null"
+	}
+
+	if isBinary(from) || isBinary(to) {
+		_, err := fmt.Fprintf(w, "Binary files %s and %s differ\n", fromName, toName)
+		return err
+	}
+
+	edits := diffEdits(splitLines(from), splitLines(to))
+
+	var builder strings.Builder
+	for start := 0; start < len(edits); {
+		// find the next change and extend the hunk while changes are close enough to share context
+		first := start
+		for first < len(edits) && edits[first].Kind == ' ' {
+			first++
+		}
+		if first >= len(edits) {
+			break
+		}
+		last := first
+		for next := first + 1; next < len(edits); next++ {
+			if edits[next].Kind == ' ' {
+				continue
+			}
+			if next-last-1 > 2*diffContextLines {
+				break
+			}
+			last = next
+		}
+
+		begin, end := first-diffContextLines, last+diffContextLines+1
+		if begin < start {
+			begin = start
+		}
+		if end > len(edits) {
+			end = len(edits)
+		}
+
+		fromStart, toStart := 0, 0
+		for _, edit := range edits[:begin] {
+			if edit.Kind != '+' {
+				fromStart++
+			}
+			if edit.Kind != '-' {
+				toStart++
+			}
+		}
+		fromLength, toLength := 0, 0
+		for _, edit := range edits[begin:end] {
+			if edit.Kind != '+' {
+				fromLength++
+			}
+			if edit.Kind != '-' {
+				toLength++
+			}
+		}
+
+		builder.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(fromStart, fromLength), hunkRange(toStart, toLength)))
+		for _, edit := range edits[begin:end] {
+			builder.WriteByte(edit.Kind)
+			builder.WriteString(edit.Line)
+			if !strings.HasSuffix(edit.Line, "\n") {
+				builder.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		start = end
+	}
+
+	if builder.Len() <= 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "--- %s\n+++ %s\n%s", fromName, toName, builder.String())
+	return err
+}
+
+// outputPlanAction names a planned change the way a dry run reports it
+func outputPlanAction(change outputChange) string {
+	switch change.Action {
+	case OutputUpdate, OutputMerge:
+		return "modify"
+	}
+	return change.Action
+}
+
+// printOutputPlan lists the files a build would create, modify or delete without touching the output directory,
+// with showDiff the unified diff of every such file is printed instead and nothing else, so the output can be applied as a patch
+func printOutputPlan(w io.Writer, changes []outputChange, showDiff bool) error {
+	counts := map[string]int{}
+	conflicts := 0
+	for _, change := range changes {
+		action := outputPlanAction(change)
+		counts[action]++
+		if change.Conflict {
+			conflicts++
+		}
+		if action == OutputKeep && change.Reason == "" {
+			continue
+		}
+
+		if showDiff {
+			switch {
+			case change.Action == OutputDelete:
+				if err := writeUnifiedDiff(w, change.Path, change.Current, nil); err != nil {
+					return ioError(err)
+				}
+			case change.Content != nil:
+				if err := writeUnifiedDiff(w, change.Path, change.Current, change.Content); err != nil {
+					return ioError(err)
+				}
+			}
+			continue
+		}
+
+		if change.Reason != "" {
+			_, _ = fmt.Fprintf(w, "%-8s %s (%s)\n", action, change.Path, change.Reason)
+		} else {
+			_, _ = fmt.Fprintf(w, "%-8s %s\n", action, change.Path)
+		}
+	}
+
+	if showDiff {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(w, "dry run: %d to create, %d to modify, %d to delete, %d conflict(s)\n",
+		counts[OutputCreate], counts["modify"], counts[OutputDelete], conflicts)
+	if err != nil {
+		return ioError(err)
+	}
+	return nil
+}
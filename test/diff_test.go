@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     []byte
+		to       []byte
+		expected string
+	}{
+		{
+			name:     "unchanged",
+			from:     []byte("a\nb\n"),
+			to:       []byte("a\nb\n"),
+			expected: "",
+		},
+		{
+			name: "modified line with context",
+			from: []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n"),
+			to:   []byte("1\n2\n3\n4\nfive\n6\n7\n8\n9\n"),
+			expected: "--- a/file.txt\n+++ b/file.txt\n" +
+				"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "distant changes in separate hunks",
+			from: []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"),
+			to:   []byte("one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n"),
+			expected: "--- a/file.txt\n+++ b/file.txt\n" +
+				"@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+				"@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+		{
+			name:     "new file",
+			from:     nil,
+			to:       []byte("a\nb\n"),
+			expected: "--- /dev/null\n+++ b/file.txt\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:     "deleted file",
+			from:     []byte("a\n"),
+			to:       nil,
+			expected: "--- a/file.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name:     "missing newline at end of file",
+			from:     []byte("a\nb"),
+			to:       []byte("a\nc"),
+			expected: "--- a/file.txt\n+++ b/file.txt\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			name:     "binary file",
+			from:     []byte("a\x00"),
+			to:       []byte("b\x00"),
+			expected: "Binary files a/file.txt and b/file.txt differ\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := writeUnifiedDiff(&buffer, "file.txt", test.from, test.to); err != nil {
+				t.Fatal(err)
+			}
+			if buffer.String() != test.expected {
+				t.Errorf("expected\n%s\ngot\n%s", test.expected, buffer.String())
+			}
+		})
+	}
+}
+
+func TestPrintOutputPlanDiffHasNoSummary(t *testing.T) {
+	changes := []outputChange{
+		{Path: "a.txt", Action: OutputUpdate, Current: []byte("a\n"), Content: []byte("b\n")},
+		{Path: "b.txt", Action: OutputKeep},
+	}
+
+	var buffer bytes.Buffer
+	if err := printOutputPlan(&buffer, changes, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buffer.String(), "--- a/a.txt\n") || strings.Contains(buffer.String(), "dry run") {
+		t.Errorf("expected only the diff, got\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	if err := printOutputPlan(&buffer, changes, false); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.String() != "modify   a.txt\ndry run: 0 to create, 1 to modify, 0 to delete, 0 conflict(s)\n" {
+		t.Errorf("unexpected plan\n%s", buffer.String())
+	}
+}
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/go-fluid/fluid"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// docsPage is the model shared by the html and markdown api references
+type docsPage struct {
+	Title       string
+	Version     string
+	Description string
+	Groups      []docsGroup
+	Contracts   []docsSchema
+}
+
+type docsGroup struct {
+	Name       string
+	Anchor     string
+	Schema     docsSchema
+	Operations []docsOperation
+}
+
+type docsOperation struct {
+	Anchor             string
+	Method             string
+	Path               string
+	Summary            string
+	Description        string
+	Authorized         bool
+	Parameters         []docsParameter
+	RequestContentType string
+	RequestType        string
+	RequestExample     string
+	Responses          []docsResponse
+}
+
+type docsParameter struct {
+	Name        string
+	In          string
+	Type        string
+	Required    bool
+	Description string
+}
+
+type docsResponse struct {
+	Status      string
+	Description string
+	ContentType string
+	Type        string
+	Example     string
+}
+
+type docsSchema struct {
+	Name       string
+	Anchor     string
+	Title      string
+	Properties []docsProperty
+}
+
+type docsProperty struct {
+	Name        string
+	Type        string
+	Required    bool
+	Access      string
+	Description string
+}
+
+// docsMethodOrder keeps the operations of a path in crud order
+var docsMethodOrder = []string{"get", "post", "put", "patch", "delete"}
+
+const (
+	docsExampleRequest  = "request"
+	docsExampleResponse = "response"
+)
+
+// docsExampleMember keeps example objects in schema order when marshalled
+type docsExampleMember struct {
+	Name  string
+	Value interface{}
+}
+
+type docsExampleObject []docsExampleMember
+
+func (o docsExampleObject) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString("{")
+	for i, member := range o {
+		if i > 0 {
+			buffer.WriteString(",")
+		}
+		name, err := json.Marshal(member.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(member.Value)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(name)
+		buffer.WriteString(":")
+		buffer.Write(value)
+	}
+	buffer.WriteString("}")
+	return buffer.Bytes(), nil
+}
+
+func docsAnchor(values ...string) string {
+	return kebabCase(strings.Join(values, " "))
+}
+
+func docsSchemaRefName(schema *OpenApiSchema) string {
+	return strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+}
+
+func docsTypeName(schema *OpenApiSchema) string {
+	if schema == nil {
+		return ""
+	}
+	if schema.Ref != "" {
+		return docsSchemaRefName(schema)
+	}
+	if schema.Type == "array" {
+		return fmt.Sprintf("array of %s", docsTypeName(schema.Items))
+	}
+	name := schema.Type
+	if schema.Format != "" {
+		name = fmt.Sprintf("%s (%s)", name, schema.Format)
+	}
+	if schema.Nullable {
+		name += ", nullable"
+	}
+	return name
+}
+
+func docsDescription(schema *OpenApiSchema) string {
+	description := schema.Description
+	if len(schema.Enum) > 0 {
+		var values []string
+		for _, value := range schema.Enum {
+			values = append(values, fmt.Sprint(value))
+		}
+		description = strings.TrimSpace(fmt.Sprintf("%s One of: %s.", description, strings.Join(values, ", ")))
+	}
+	if schema.Pattern != "" {
+		description = strings.TrimSpace(fmt.Sprintf("%s Must match `%s`.", description, schema.Pattern))
+	}
+	return description
+}
+
+// docsExampleValue builds an example value for a schema, read only properties are left out of requests and write only properties out of responses
+func docsExampleValue(document *OpenApi, schema *OpenApiSchema, mode string, depth int) interface{} {
+	if schema == nil || depth > 8 {
+		return nil
+	}
+
+	if schema.Ref != "" {
+		return docsExampleValue(document, document.Components.Schemas[docsSchemaRefName(schema)], mode, depth+1)
+	}
+
+	if schema.Default != nil {
+		return schema.Default
+	}
+	if len(schema.Enum) > 0 {
+		return schema.Enum[0]
+	}
+
+	switch schema.Type {
+	case "array":
+		return []interface{}{docsExampleValue(document, schema.Items, mode, depth+1)}
+	case "object":
+		object := docsExampleObject{}
+		for _, name := range schema.order {
+			property := schema.Properties[name]
+			if (mode == docsExampleRequest && property.ReadOnly) || (mode == docsExampleResponse && property.WriteOnly) {
+				continue
+			}
+			object = append(object, docsExampleMember{Name: name, Value: docsExampleValue(document, property, mode, depth+1)})
+		}
+		if len(object) <= 0 && schema.AdditionalProperties == true {
+			object = append(object, docsExampleMember{Name: "key", Value: "value"})
+		}
+		return object
+	case "integer":
+		return 1
+	case "number":
+		return 1.5
+	case "boolean":
+		return true
+	}
+
+	switch schema.Format {
+	case "date":
+		return "2021-10-21"
+	case "date-time":
+		return "2021-10-21T08:42:16Z"
+	case "time":
+		return "08:42:16"
+	case "uuid":
+		return "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	case "password":
+		return "********"
+	case "byte":
+		return "Zmx1aWQ="
+	case "binary":
+		return "<binary>"
+	}
+	return "string"
+}
+
+func docsExample(document *OpenApi, schema *OpenApiSchema, mode string) (string, error) {
+	if schema == nil || schema.Format == "binary" {
+		return "", nil
+	}
+	data, err := json.MarshalIndent(docsExampleValue(document, schema, mode, 0), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func newDocsSchema(name string, schema *OpenApiSchema) docsSchema {
+	result := docsSchema{Name: name, Anchor: docsAnchor("schema", name), Title: schema.Title}
+	required := map[string]bool{}
+	for _, property := range schema.Required {
+		required[property] = true
+	}
+	for _, property := range schema.order {
+		value := schema.Properties[property]
+		access := ""
+		if value.ReadOnly {
+			access = "read only"
+		} else if value.WriteOnly {
+			access = "write only"
+		}
+		result.Properties = append(result.Properties, docsProperty{
+			Name:        property,
+			Type:        docsTypeName(value),
+			Required:    required[property],
+			Access:      access,
+			Description: docsDescription(value),
+		})
+	}
+	return result
+}
+
+// docsContent picks the single media type of a request or response, the generator never emits more than one
+func docsContent(content map[string]OpenApiMediaType) (string, *OpenApiSchema) {
+	for contentType, mediaType := range content {
+		return contentType, mediaType.Schema
+	}
+	return "", nil
+}
+
+func newDocsOperation(document *OpenApi, path, method string, operation *OpenApiOperation) (docsOperation, error) {
+	result := docsOperation{
+		Anchor:      docsAnchor(operation.OperationId),
+		Method:      strings.ToUpper(method),
+		Path:        path,
+		Summary:     operation.Summary,
+		Description: operation.Description,
+		Authorized:  len(operation.Security) > 0,
+	}
+
+	for _, parameter := range operation.Parameters {
+		result.Parameters = append(result.Parameters, docsParameter{
+			Name:        parameter.Name,
+			In:          parameter.In,
+			Type:        docsTypeName(parameter.Schema),
+			Required:    parameter.Required,
+			Description: parameter.Description,
+		})
+	}
+
+	if operation.RequestBody != nil {
+		contentType, schema := docsContent(operation.RequestBody.Content)
+		example, err := docsExample(document, schema, docsExampleRequest)
+		if err != nil {
+			return result, err
+		}
+		result.RequestContentType = contentType
+		result.RequestType = docsTypeName(schema)
+		result.RequestExample = example
+	}
+
+	var statuses []string
+	for status := range operation.Responses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	for _, status := range statuses {
+		response := operation.Responses[status]
+		contentType, schema := docsContent(response.Content)
+		example, err := docsExample(document, schema, docsExampleResponse)
+		if err != nil {
+			return result, err
+		}
+		result.Responses = append(result.Responses, docsResponse{
+			Status:      status,
+			Description: response.Description,
+			ContentType: contentType,
+			Type:        docsTypeName(schema),
+			Example:     example,
+		})
+	}
+
+	return result, nil
+}
+
+// newDocsPage groups the openapi operations by entity in schema order
+func newDocsPage(project fluid.Project, document *OpenApi) (docsPage, error) {
+	page := docsPage{
+		Title:       document.Info.Title,
+		Version:     document.Info.Version,
+		Description: document.Info.Description,
+	}
+
+	var paths []string
+	for path := range document.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, entity := range project.Entities {
+		name := entitySchemaName(entity)
+		tag := titleCase(entity.NamePlural)
+		group := docsGroup{
+			Name:   tag,
+			Anchor: docsAnchor(tag),
+			Schema: newDocsSchema(name, document.Components.Schemas[name]),
+		}
+
+		for _, path := range paths {
+			for _, method := range docsMethodOrder {
+				operation, ok := document.Paths[path][method]
+				if !ok || len(operation.Tags) <= 0 || operation.Tags[0] != tag {
+					continue
+				}
+				docsOperation, err := newDocsOperation(document, path, method, operation)
+				if err != nil {
+					return page, fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err)
+				}
+				group.Operations = append(group.Operations, docsOperation)
+			}
+		}
+
+		page.Groups = append(page.Groups, group)
+	}
+
+	for _, contract := range project.Contracts {
+		name := contractSchemaName(contract)
+		page.Contracts = append(page.Contracts, newDocsSchema(name, document.Components.Schemas[name]))
+	}
+
+	return page, nil
+}
+
+// markdownCell keeps a value on a single markdown table row
+func markdownCell(value string) string {
+	value = strings.ReplaceAll(value, "|", "\\|")
+	return strings.Join(strings.Fields(value), " ")
+}
+
+var apiDocsMarkdownTemplate = `# {{ .Title }} API reference
+
+Version {{ .Version }}
+{{- if .Description }}
+
+{{ .Description }}
+{{- end }}
+
+Requests marked as authorized require an ` + "`Authorization: Bearer <token>`" + ` header.
+
+## Contents
+{{ range .Groups }}
+- [{{ .Name }}](#{{ .Anchor }})
+{{- range .Operations }}
+  - [{{ .Method }} {{ .Path }}](#{{ .Anchor }})
+{{- end }}
+{{- end }}
+{{- if .Contracts }}
+- [Contracts](#contracts)
+{{- end }}
+{{ range .Groups }}
+## {{ .Name }}
+
+{{ template "schema" .Schema }}
+{{- range .Operations }}
+
+<a id="{{ .Anchor }}"></a>
+
+### {{ .Method }} {{ .Path }}
+
+{{ .Summary }}{{ if .Authorized }} (authorized){{ end }}
+{{- if .Description }}
+
+{{ .Description }}
+{{- end }}
+{{- if .Parameters }}
+
+| Parameter | In | Type | Required | Description |
+|-----------|----|------|----------|-------------|
+{{- range .Parameters }}
+| ` + "`{{ .Name }}`" + ` | {{ .In }} | {{ Cell .Type }} | {{ if .Required }}yes{{ else }}no{{ end }} | {{ Cell .Description }} |
+{{- end }}
+{{- end }}
+{{- if .RequestContentType }}
+
+Request body ({{ .RequestContentType }}): {{ .RequestType }}
+{{- if .RequestExample }}
+
+` + "```json" + `
+{{ .RequestExample }}
+` + "```" + `
+{{- end }}
+{{- end }}
+{{- range .Responses }}
+
+Response {{ .Status }}: {{ .Description }}{{ if .ContentType }} ({{ .ContentType }}{{ if .Type }}, {{ .Type }}{{ end }}){{ end }}
+{{- if .Example }}
+
+` + "```json" + `
+{{ .Example }}
+` + "```" + `
+{{- end }}
+{{- end }}
+{{- end }}
+{{ end }}
+{{- if .Contracts }}
+## Contracts
+{{ range .Contracts }}
+{{ template "schema" . }}
+{{ end }}
+{{- end }}
+
+{{- define "schema" }}<a id="{{ .Anchor }}"></a>
+
+#### {{ .Name }}
+
+| Field | Type | Required | Description |
+|-------|------|----------|-------------|
+{{- range .Properties }}
+| ` + "`{{ .Name }}`" + ` | {{ Cell .Type }} | {{ if .Required }}yes{{ else }}no{{ end }} | {{ if .Access }}({{ .Access }}) {{ end }}{{ Cell .Description }} |
+{{- end }}
+{{- end }}
+`
+
+var apiDocsHtmlTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .Title }} API reference</title>
+<style>
+body { margin: 0; font: 15px/1.5 -apple-system, "Segoe UI", Roboto, Helvetica, Arial, sans-serif; color: #1f2328; display: flex; }
+nav { position: sticky; top: 0; height: 100vh; overflow-y: auto; width: 280px; flex-shrink: 0; padding: 24px 16px; box-sizing: border-box; background: #f6f8fa; border-right: 1px solid #d0d7de; font-size: 13px; }
+nav ul { list-style: none; margin: 0; padding: 0 0 0 12px; }
+nav > ul { padding: 0; }
+nav a { color: #1f2328; text-decoration: none; display: block; padding: 2px 0; }
+nav a:hover { color: #0969da; }
+main { padding: 24px 40px; max-width: 960px; min-width: 0; }
+h1 { margin-top: 0; }
+h2 { border-bottom: 1px solid #d0d7de; padding-bottom: 8px; margin-top: 48px; }
+section.operation { border: 1px solid #d0d7de; border-radius: 6px; padding: 0 16px 16px; margin: 24px 0; }
+.method { display: inline-block; min-width: 64px; text-align: center; border-radius: 4px; padding: 2px 8px; color: #fff; font-size: 12px; font-weight: 600; }
+.method-get { background: #1f883d; }
+.method-post { background: #0969da; }
+.method-put, .method-patch { background: #9a6700; }
+.method-delete { background: #cf222e; }
+.authorized { font-size: 12px; color: #57606a; margin-left: 8px; }
+code, pre { font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; font-size: 13px; }
+pre { background: #f6f8fa; border-radius: 6px; padding: 12px; overflow-x: auto; }
+table { border-collapse: collapse; width: 100%; margin: 12px 0; font-size: 14px; }
+th, td { border: 1px solid #d0d7de; padding: 6px 10px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+.muted { color: #57606a; }
+</style>
+</head>
+<body>
+<nav>
+<ul>
+{{- range .Groups }}
+<li><a href="#{{ .Anchor }}"><strong>{{ .Name }}</strong></a>
+<ul>
+{{- range .Operations }}
+<li><a href="#{{ .Anchor }}">{{ .Method }} {{ .Path }}</a></li>
+{{- end }}
+</ul>
+</li>
+{{- end }}
+{{- if .Contracts }}
+<li><a href="#contracts"><strong>Contracts</strong></a>
+<ul>
+{{- range .Contracts }}
+<li><a href="#{{ .Anchor }}">{{ .Name }}</a></li>
+{{- end }}
+</ul>
+</li>
+{{- end }}
+</ul>
+</nav>
+<main>
+<h1>{{ .Title }} API reference</h1>
+<p class="muted">Version {{ .Version }}</p>
+{{- if .Description }}
+<p>{{ .Description }}</p>
+{{- end }}
+<p>Operations marked as authorized require an <code>Authorization: Bearer &lt;token&gt;</code> header.</p>
+{{- range .Groups }}
+<h2 id="{{ .Anchor }}">{{ .Name }}</h2>
+{{ template "schema" .Schema }}
+{{- range .Operations }}
+<section class="operation" id="{{ .Anchor }}">
+<h3><span class="method method-{{ .Method | Lower }}">{{ .Method }}</span> <code>{{ .Path }}</code>{{ if .Authorized }}<span class="authorized">authorized</span>{{ end }}</h3>
+<p>{{ .Summary }}</p>
+{{- if .Description }}
+<p class="muted">{{ .Description }}</p>
+{{- end }}
+{{- if .Parameters }}
+<table>
+<tr><th>Parameter</th><th>In</th><th>Type</th><th>Required</th><th>Description</th></tr>
+{{- range .Parameters }}
+<tr><td><code>{{ .Name }}</code></td><td>{{ .In }}</td><td>{{ .Type }}</td><td>{{ if .Required }}yes{{ else }}no{{ end }}</td><td>{{ .Description }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .RequestContentType }}
+<h4>Request body <span class="muted">{{ .RequestContentType }}, {{ .RequestType }}</span></h4>
+{{- if .RequestExample }}
+<pre>{{ .RequestExample }}</pre>
+{{- end }}
+{{- end }}
+{{- range .Responses }}
+<h4>Response {{ .Status }} <span class="muted">{{ .Description }}{{ if .ContentType }} {{ .ContentType }}{{ if .Type }}, {{ .Type }}{{ end }}{{ end }}</span></h4>
+{{- if .Example }}
+<pre>{{ .Example }}</pre>
+{{- end }}
+{{- end }}
+</section>
+{{- end }}
+{{- end }}
+{{- if .Contracts }}
+<h2 id="contracts">Contracts</h2>
+{{- range .Contracts }}
+{{ template "schema" . }}
+{{- end }}
+{{- end }}
+</main>
+</body>
+</html>
+{{- define "schema" }}
+<h4 id="{{ .Anchor }}">{{ .Name }}</h4>
+<table>
+<tr><th>Field</th><th>Type</th><th>Required</th><th>Description</th></tr>
+{{- range .Properties }}
+<tr><td><code>{{ .Name }}</code></td><td>{{ .Type }}</td><td>{{ if .Required }}yes{{ else }}no{{ end }}</td><td>{{ if .Access }}<span class="muted">({{ .Access }})</span> {{ end }}{{ .Description }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+`
+
+// buildApiDocs writes a self-contained html and markdown api reference into the docs directory of the api project
+var buildApiDocs = func(project fluid.Project, document *OpenApi, directory string) error {
+	page, err := newDocsPage(project, document)
+	if err != nil {
+		return err
+	}
+
+	docsDirectory := filepath.Join(directory, "docs")
+	if err := os.MkdirAll(docsDirectory, os.ModePerm); err != nil {
+		return ioError(err)
+	}
+
+	markdownTmpl, err := template.New("markdown").Funcs(
+		template.FuncMap{
+			"Cell": markdownCell,
+		},
+	).Parse(
+		apiDocsMarkdownTemplate,
+	)
+	if err != nil {
+		return err
+	}
+
+	var markdown bytes.Buffer
+	if err := markdownTmpl.Execute(&markdown, page); err != nil {
+		return err
+	}
+
+	htmlTmpl, err := htmltemplate.New("html").Funcs(
+		htmltemplate.FuncMap{
+			"Lower": strings.ToLower,
+		},
+	).Parse(
+		apiDocsHtmlTemplate,
+	)
+	if err != nil {
+		return err
+	}
+
+	var html bytes.Buffer
+	if err := htmlTmpl.Execute(&html, page); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(docsDirectory, "api.md"), markdown.Bytes(), os.ModePerm); err != nil {
+		return ioError(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(docsDirectory, "index.html"), html.Bytes(), os.ModePerm); err != nil {
+		return ioError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// embeddedTemplateRoots maps every base template to the minimal version of it embedded in the binary
+var embeddedTemplateRoots = map[string]string{
+	"api":            "templates/api",
+	"logic":          "templates/logic",
+	"portal-ionic":   "templates/portal",
+	"portal-vuetify": "templates/portal",
+}
+
+// embeddedFileSuffix is stripped from embedded file names, go.mod files carry it because a go.mod would exclude its directory from the binary
+const embeddedFileSuffix = ".embed"
+
+// extractEmbeddedTemplate writes the embedded version of a base template to a directory, replacing whatever was there
+var extractEmbeddedTemplate = func(name, directory string) error {
+	root, ok := embeddedTemplateRoots[name]
+	if !ok {
+		return cacheError(fmt.Errorf("template '%s' has no embedded version", name))
+	}
+
+	if err := os.RemoveAll(directory); err != nil {
+		return ioError(err)
+	}
+
+	return fs.WalkDir(embeddedTemplates, root, func(embeddedPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		targetPath := filepath.Join(directory, filepath.FromSlash(strings.TrimSuffix(strings.TrimPrefix(embeddedPath, root), embeddedFileSuffix)))
+		if entry.IsDir() {
+			if err := os.MkdirAll(targetPath, os.ModePerm); err != nil {
+				return ioError(err)
+			}
+			return nil
+		}
+
+		data, err := embeddedTemplates.ReadFile(path.Clean(embeddedPath))
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(targetPath, data, 0644); err != nil {
+			return ioError(err)
+		}
+		return nil
+	})
+}
+
+// offlineTemplateDirectories resolves every base template without network access: the locked release when there is a lock,
+// the latest cached release otherwise. With an embedded directory, templates that are neither locked nor cached fall back
+// to the embedded template extracted below it, a locked release is never replaced
+var offlineTemplateDirectories = func(lock *LockFile, embeddedDirectory string) (map[string]string, error) {
+	templateRepositories, err := getTemplateRepositories()
+	if err != nil {
+		return nil, err
+	}
+
+	directories := map[string]string{}
+	for _, templateRepository := range templateRepositories {
+		if templateRepository.Source.Type == TemplateSourceDirectory {
+			directories[templateRepository.Name] = templateRepository.Source.Path
+			continue
+		}
+
+		if lock != nil {
+			if locked, ok := lock.template(templateRepository.Name); ok {
+				directory := filepath.Join(templateRepository.CacheDirectory, locked.Tag)
+				if _, err := os.Stat(directory); err != nil {
+					return nil, cacheError(fmt.Errorf("template '%s': locked release '%s' is not cached, build online to download it", templateRepository.Name, locked.Tag))
+				}
+				directories[templateRepository.Name] = directory
+				continue
+			}
+		}
+
+		directory := filepath.Join(templateRepository.CacheDirectory, "latest")
+		if _, err := os.Stat(directory); err == nil {
+			directories[templateRepository.Name] = directory
+			continue
+		}
+		if embeddedDirectory == "" {
+			return nil, cacheError(fmt.Errorf("template '%s': the latest release is not cached, build online to download it or with -embedded-templates to use the minimal embedded template", templateRepository.Name))
+		}
+
+		directory = filepath.Join(embeddedDirectory, templateRepository.Name)
+		if err := extractEmbeddedTemplate(templateRepository.Name, directory); err != nil {
+			return nil, fmt.Errorf("template '%s': %w", templateRepository.Name, err)
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "warning: template '%s': the latest release is not cached, using the minimal embedded template\n", templateRepository.Name)
+		directories[templateRepository.Name] = directory
+	}
+
+	return directories, nil
+}
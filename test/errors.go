@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"github.com/go-playground/validator/v10"
+)
+
+// exit codes allow scripts to tell apart the different classes of failure
+const (
+	ExitCodeOk         = 0
+	ExitCodeFailure    = 1
+	ExitCodeUsage      = 2
+	ExitCodeValidation = 3
+	ExitCodeCache      = 4
+	ExitCodeIO         = 5
+	ExitCodeConflict   = 6
+)
+
+// ErrorKind classifies an error so that it can be mapped to an exit code
+type ErrorKind int
+
+const (
+	ErrorKindFailure ErrorKind = iota
+	ErrorKindUsage
+	ErrorKindValidation
+	ErrorKindCache
+	ErrorKindIO
+	ErrorKindConflict
+)
+
+// Error attaches an ErrorKind to an error, the outermost kind wins when errors are wrapped so callers can reclassify an error
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func kindError(kind ErrorKind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// usageError marks an invalid command line
+func usageError(err error) error {
+	return kindError(ErrorKindUsage, err)
+}
+
+// validationError marks a schema that could not be read or did not pass validation
+func validationError(err error) error {
+	return kindError(ErrorKindValidation, err)
+}
+
+// cacheError marks a failure to resolve, download or extract a base template
+func cacheError(err error) error {
+	return kindError(ErrorKindCache, err)
+}
+
+// ioError marks a failure to read or write local files
+func ioError(err error) error {
+	return kindError(ErrorKindIO, err)
+}
+
+// conflictError marks a build whose output has merge conflicts with local changes
+func conflictError(err error) error {
+	return kindError(ErrorKindConflict, err)
+}
+
+func exitCode(err error) int {
+	if err == nil || err == flag.ErrHelp {
+		return ExitCodeOk
+	}
+
+	if err == errUsage {
+		return ExitCodeUsage
+	}
+
+	var kindErr *Error
+	if errors.As(err, &kindErr) {
+		switch kindErr.Kind {
+		case ErrorKindUsage:
+			return ExitCodeUsage
+		case ErrorKindValidation:
+			return ExitCodeValidation
+		case ErrorKindCache:
+			return ExitCodeCache
+		case ErrorKindIO:
+			return ExitCodeIO
+		case ErrorKindConflict:
+			return ExitCodeConflict
+		}
+	}
+
+	var schemaErr *SchemaError
+	if errors.As(err, &schemaErr) {
+		return ExitCodeValidation
+	}
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return ExitCodeValidation
+	}
+
+	return ExitCodeFailure
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-fluid/fluid"
+	"strings"
+)
+
+const (
+	LinkRelationshipOneToOne   = "one-to-one"
+	LinkRelationshipOneToMany  = "one-to-many"
+	LinkRelationshipManyToMany = "many-to-many"
+)
+
+// EntityLink is a field referencing records of another entity, stored as the object id(s) of those records
+type EntityLink struct {
+	Group        string `json:"group,omitempty"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Label        string `json:"label,omitempty"`
+	EntityKey    string `json:"entityKey"` // kebab case singular name of the linked entity
+	Relationship string `json:"relationship"`
+	IsOptional   bool   `json:"isOptional,omitempty"`
+}
+
+// IsMultiple reports whether the link holds several records rather than one
+func (l EntityLink) IsMultiple() bool {
+	return l.Relationship == LinkRelationshipOneToMany || l.Relationship == LinkRelationshipManyToMany
+}
+
+// EntityExtension holds entity features the fluid package does not model, they are written inline with the entity in schema files
+type EntityExtension struct {
+	Links      []EntityLink          `json:"links,omitempty"`
+	Attributes []AttributeConstraint `json:"attributes,omitempty"`
+	List       []ListColumn          `json:"list,omitempty"`
+
+	// Permissions restricts account types, keyed by account entity key, to the listed crud operations and actions
+	Permissions map[string][]string `json:"permissions,omitempty"`
+}
+
+func (e EntityExtension) isEmpty() bool {
+	return len(e.Links) <= 0 && len(e.Attributes) <= 0 && len(e.List) <= 0 && len(e.Permissions) <= 0
+}
+
+// ProjectExtensions holds the extensions of each entity keyed by entity key
+type ProjectExtensions map[string]EntityExtension
+
+func (e ProjectExtensions) entity(entity fluid.Entity) EntityExtension {
+	if e == nil {
+		return EntityExtension{}
+	}
+	return e[entityKey(entity)]
+}
+
+// schemaEntity is an entity as it is written in schema files
+type schemaEntity struct {
+	fluid.Entity
+	EntityExtension
+}
+
+// schemaProject is a project as it is written in schema files, the entities shadow the embedded project's entities
+type schemaProject struct {
+	fluid.Project
+	Entities []schemaEntity `json:"entities,omitempty"`
+}
+
+func newSchemaProject(project fluid.Project, extensions ProjectExtensions) schemaProject {
+	schema := schemaProject{Project: project}
+	for _, entity := range project.Entities {
+		schema.Entities = append(schema.Entities, schemaEntity{
+			Entity:          entity,
+			EntityExtension: extensions.entity(entity),
+		})
+	}
+	return schema
+}
+
+// entityKey identifies an entity in references such as portal account entity keys and links
+func entityKey(entity fluid.Entity) string {
+	return kebabCase(entity.NameSingular)
+}
+
+func findEntity(project fluid.Project, key string) (fluid.Entity, bool) {
+	for _, entity := range project.Entities {
+		if entityKey(entity) == kebabCase(key) {
+			return entity, true
+		}
+	}
+	return fluid.Entity{}, false
+}
+
+// resolvedLink is a link along with the entity it references
+type resolvedLink struct {
+	EntityLink
+	Target fluid.Entity
+}
+
+func resolveLinks(project fluid.Project, extension EntityExtension) ([]resolvedLink, error) {
+	links := make([]resolvedLink, 0, len(extension.Links))
+	for _, link := range extension.Links {
+		target, ok := findEntity(project, link.EntityKey)
+		if !ok {
+			return nil, validationError(fmt.Errorf("link '%s': entity '%s' does not exist", link.Name, link.EntityKey))
+		}
+		links = append(links, resolvedLink{EntityLink: link, Target: target})
+	}
+	return links, nil
+}
+
+func linkGoType(link EntityLink) string {
+	t := goType{Name: "primitive.ObjectID", Import: goImportPrimitive}
+	return goTypeName(t, link.IsMultiple(), link.IsOptional)
+}
+
+var validateExtensions = func(project fluid.Project, extensions ProjectExtensions) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for i, entity := range project.Entities {
+		names := map[string]bool{}
+		for _, field := range entity.Fields {
+			names[camelCase(field.Name)] = true
+		}
+
+		for j, link := range extensions.entity(entity).Links {
+			pointer := fmt.Sprintf("/entities/%d/links/%d", i, j)
+
+			if strings.TrimSpace(link.Name) == "" {
+				diagnostics = append(diagnostics, Diagnostic{Path: pointer + "/name", Severity: SeverityError, Message: "is required"})
+			} else if names[camelCase(link.Name)] || isAuditFieldName(link.Name, entityAuditFieldNames(entity)) {
+				diagnostics = append(diagnostics, Diagnostic{Path: pointer + "/name", Severity: SeverityError, Message: fmt.Sprintf("link '%s' clashes with another field of entity '%s'", link.Name, entity.NameSingular)})
+			}
+			names[camelCase(link.Name)] = true
+
+			if strings.TrimSpace(link.Description) == "" {
+				diagnostics = append(diagnostics, Diagnostic{Path: pointer + "/description", Severity: SeverityError, Message: "is required"})
+			}
+
+			if strings.TrimSpace(link.EntityKey) == "" {
+				diagnostics = append(diagnostics, Diagnostic{Path: pointer + "/entityKey", Severity: SeverityError, Message: "is required"})
+			} else if _, ok := findEntity(project, link.EntityKey); !ok {
+				diagnostics = append(diagnostics, Diagnostic{Path: pointer + "/entityKey", Severity: SeverityError, Message: fmt.Sprintf("entity '%s' does not exist", link.EntityKey)})
+			}
+
+			switch link.Relationship {
+			case LinkRelationshipOneToOne, LinkRelationshipOneToMany, LinkRelationshipManyToMany:
+			default:
+				diagnostics = append(diagnostics, Diagnostic{
+					Path:     pointer + "/relationship",
+					Severity: SeverityError,
+					Message:  fmt.Sprintf("'%s' is not a valid link relationship, expected one of: %s, %s, %s", link.Relationship, LinkRelationshipOneToOne, LinkRelationshipOneToMany, LinkRelationshipManyToMany),
+				})
+			}
+		}
+	}
+
+	diagnostics = append(diagnostics, validateAttributeConstraints(project, extensions)...)
+	diagnostics = append(diagnostics, validateListColumns(project, extensions)...)
+	return append(diagnostics, validatePermissions(project, extensions)...)
+}
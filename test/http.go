@@ -0,0 +1,357 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHttpTimeout         = 10 * time.Second
+	defaultHttpDownloadTimeout = 5 * time.Minute
+	defaultHttpRetries         = 3
+	defaultHttpMaxRateLimit    = time.Minute
+	httpBackoffBase            = 500 * time.Millisecond
+	httpBackoffMax             = 30 * time.Second
+)
+
+// access tokens are read from FLUID_TOKEN, then the config, then GITHUB_TOKEN
+const (
+	fluidTokenEnvironmentVariable  = "FLUID_TOKEN"
+	githubTokenEnvironmentVariable = "GITHUB_TOKEN"
+)
+
+// HttpConfig tunes how release info and tarballs are fetched, durations use go syntax such as 30s or 2m
+type HttpConfig struct {
+	Token            string   `json:"token,omitempty"`            // access token sent as a bearer token
+	TokenHosts       []string `json:"tokenHosts,omitempty"`       // hosts the token is sent to, defaults to api.github.com and the github sources
+	Timeout          string   `json:"timeout,omitempty"`          // timeout of release info requests, defaults to 10s
+	DownloadTimeout  string   `json:"downloadTimeout,omitempty"`  // timeout of tarball downloads, defaults to 5m
+	Retries          *int     `json:"retries,omitempty"`          // retries of transient failures, defaults to 3
+	MaxRateLimitWait string   `json:"maxRateLimitWait,omitempty"` // longest rate limit reset waited for before failing, defaults to 1m
+	Proxy            string   `json:"proxy,omitempty"`            // proxy url, defaults to the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+}
+
+func (c HttpConfig) validate() error {
+	for name, value := range map[string]string{"timeout": c.Timeout, "downloadTimeout": c.DownloadTimeout, "maxRateLimitWait": c.MaxRateLimitWait} {
+		if value == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(value); err != nil || duration < 0 {
+			return fmt.Errorf("http %s '%s' is not a valid duration", name, value)
+		}
+	}
+	if c.Retries != nil && *c.Retries < 0 {
+		return fmt.Errorf("http retries may not be negative")
+	}
+	if c.Proxy != "" {
+		if proxy, err := url.Parse(c.Proxy); err != nil || proxy.Host == "" {
+			return fmt.Errorf("http proxy '%s' is not a valid url", c.Proxy)
+		}
+	}
+	return nil
+}
+
+// httpSettings is the resolved http config
+type httpSettings struct {
+	token            string
+	tokenHosts       map[string]bool
+	timeout          time.Duration
+	downloadTimeout  time.Duration
+	retries          int
+	maxRateLimitWait time.Duration
+	proxy            *url.URL
+}
+
+func durationOrDefault(value string, defaultValue time.Duration) time.Duration {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return duration
+	}
+	return defaultValue
+}
+
+var loadHttpSettings = func() (httpSettings, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return httpSettings{}, err
+	}
+
+	settings := httpSettings{
+		token:            os.Getenv(fluidTokenEnvironmentVariable),
+		tokenHosts:       map[string]bool{},
+		timeout:          durationOrDefault(config.Http.Timeout, defaultHttpTimeout),
+		downloadTimeout:  durationOrDefault(config.Http.DownloadTimeout, defaultHttpDownloadTimeout),
+		retries:          defaultHttpRetries,
+		maxRateLimitWait: durationOrDefault(config.Http.MaxRateLimitWait, defaultHttpMaxRateLimit),
+	}
+	if settings.token == "" {
+		settings.token = config.Http.Token
+	}
+	if settings.token == "" {
+		settings.token = os.Getenv(githubTokenEnvironmentVariable)
+	}
+	if config.Http.Retries != nil {
+		settings.retries = *config.Http.Retries
+	}
+	if config.Http.Proxy != "" {
+		if settings.proxy, err = url.Parse(config.Http.Proxy); err != nil {
+			return settings, validationError(err)
+		}
+	}
+
+	// the token is only ever sent to github hosts, never to arbitrary tarball servers
+	tokenHosts := config.Http.TokenHosts
+	if len(tokenHosts) <= 0 {
+		tokenHosts = []string{strings.TrimPrefix(defaultGithubApiUrl, "https://")}
+		for _, source := range config.Templates {
+			if (source.Type == "" || source.Type == TemplateSourceGithub) && source.BaseUrl != "" {
+				if baseUrl, err := url.Parse(source.BaseUrl); err == nil {
+					tokenHosts = append(tokenHosts, baseUrl.Host)
+				}
+			}
+		}
+	}
+	for _, host := range tokenHosts {
+		settings.tokenHosts[strings.ToLower(host)] = true
+	}
+
+	return settings, nil
+}
+
+func (s httpSettings) client(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if s.proxy != nil {
+		transport.Proxy = http.ProxyURL(s.proxy)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func (s httpSettings) newRequest(uri string, header http.Header) (*http.Request, error) {
+	request, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	request.Header.Set("User-Agent", "fluid-cli/"+version)
+	if s.token != "" && s.tokenHosts[strings.ToLower(request.URL.Host)] {
+		request.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	return request, nil
+}
+
+// backoff returns the jittered exponential delay before a retry, between half and all of base * 2^attempt
+func backoff(attempt int) time.Duration {
+	delay := httpBackoffBase << uint(attempt)
+	if delay <= 0 || delay > httpBackoffMax {
+		delay = httpBackoffMax
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// rateLimitWait returns how long a rate limited response asks to wait, ok is false for responses that are not rate limited
+func rateLimitWait(response *http.Response, now time.Time) (time.Duration, bool) {
+	if response.StatusCode != http.StatusForbidden && response.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if retryAfter := response.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if at, err := http.ParseTime(retryAfter); err == nil {
+			return at.Sub(now), true
+		}
+	}
+	if response.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(response.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Unix(reset, 0).Sub(now), true
+		}
+		return httpBackoffMax, true
+	}
+	if response.StatusCode == http.StatusTooManyRequests {
+		return 0, true
+	}
+	return 0, false
+}
+
+func isTransientStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusBadGateway || code == http.StatusServiceUnavailable ||
+		code == http.StatusGatewayTimeout || code == http.StatusInternalServerError
+}
+
+var sleep = time.Sleep
+
+// sendRequest gets a url, waiting out rate limits and retrying network errors and transient statuses with jittered backoff
+var sendRequest = func(settings httpSettings, client *http.Client, uri string, header http.Header) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		request, err := settings.newRequest(uri, header)
+		if err != nil {
+			return nil, cacheError(err)
+		}
+
+		response, err := client.Do(request)
+		if err != nil {
+			if attempt >= settings.retries {
+				return nil, cacheError(err)
+			}
+			sleep(backoff(attempt))
+			continue
+		}
+
+		if wait, limited := rateLimitWait(response, time.Now()); limited {
+			_ = response.Body.Close()
+			if wait > settings.maxRateLimitWait || attempt >= settings.retries {
+				message := fmt.Sprintf("GET %s: rate limited for another %s", uri, wait.Round(time.Second))
+				if settings.token == "" {
+					message += fmt.Sprintf(", set $%s or http.token in the config to raise the limit", fluidTokenEnvironmentVariable)
+				}
+				return nil, cacheError(fmt.Errorf("%s", message))
+			}
+			if wait <= 0 {
+				wait = backoff(attempt)
+			}
+			sleep(wait)
+			continue
+		}
+
+		if isTransientStatus(response.StatusCode) && attempt < settings.retries {
+			_ = response.Body.Close()
+			sleep(backoff(attempt))
+			continue
+		}
+
+		return response, nil
+	}
+}
+
+// httpCacheEntry keeps the last response of a release info url so it can be revalidated with If-None-Match
+type httpCacheEntry struct {
+	Url  string          `json:"url"`
+	ETag string          `json:"etag"`
+	Body json.RawMessage `json:"body"`
+}
+
+func httpCachePath(uri string) (string, error) {
+	cacheDirectory, err := getCacheDirectory()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(uri))
+	return filepath.Join(cacheDirectory, "http", hex.EncodeToString(hash[:])+".json"), nil
+}
+
+func readHttpCache(uri string) *httpCacheEntry {
+	path, err := httpCachePath(uri)
+	if err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var entry httpCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Url != uri || entry.ETag == "" {
+		return nil
+	}
+	return &entry
+}
+
+func writeHttpCache(entry httpCacheEntry) error {
+	path, err := httpCachePath(entry.Url)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return ioError(err)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return ioError(err)
+	}
+	return nil
+}
+
+func httpCacheDirectory() (string, error) {
+	cacheDirectory, err := getCacheDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDirectory, "http"), nil
+}
+
+// removeHttpCache removes the cached responses of the given urls, without urls the whole http cache is removed
+var removeHttpCache = func(uris []string) error {
+	if len(uris) <= 0 {
+		directory, err := httpCacheDirectory()
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(directory); err != nil {
+			return ioError(err)
+		}
+		return nil
+	}
+
+	for _, uri := range uris {
+		path, err := httpCachePath(uri)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return ioError(err)
+		}
+	}
+	return nil
+}
+
+// pruneHttpCache removes the cached responses of urls that are no longer fetched, it returns the number and size of
+// the removed responses
+var pruneHttpCache = func(uris []string) (int, int64, error) {
+	directory, err := httpCacheDirectory()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	entries, err := ioutil.ReadDir(directory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, ioError(err)
+	}
+
+	kept := map[string]bool{}
+	for _, uri := range uris {
+		if path, err := httpCachePath(uri); err == nil {
+			kept[filepath.Base(path)] = true
+		}
+	}
+
+	removed := 0
+	var size int64
+	for _, entry := range entries {
+		if entry.IsDir() || kept[entry.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(directory, entry.Name())); err != nil {
+			return removed, size, ioError(err)
+		}
+		removed++
+		size += entry.Size()
+	}
+	return removed, size, nil
+}
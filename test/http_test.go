@@ -0,0 +1,223 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingServer answers with the responses in order, repeating the last one, and records every request
+type recordingServer struct {
+	*httptest.Server
+	mutex     sync.Mutex
+	requests  []*http.Request
+	responses []func(w http.ResponseWriter, r *http.Request)
+}
+
+func newRecordingServer(t *testing.T, responses ...func(w http.ResponseWriter, r *http.Request)) *recordingServer {
+	t.Helper()
+
+	server := &recordingServer{responses: responses}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mutex.Lock()
+		index := len(server.requests)
+		server.requests = append(server.requests, r.Clone(r.Context()))
+		server.mutex.Unlock()
+
+		if index >= len(server.responses) {
+			index = len(server.responses) - 1
+		}
+		server.responses[index](w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func status(code int, header map[string]string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for key, value := range header {
+			w.Header().Set(key, value)
+		}
+		w.WriteHeader(code)
+	}
+}
+
+func body(content string, header map[string]string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for key, value := range header {
+			w.Header().Set(key, value)
+		}
+		_, _ = w.Write([]byte(content))
+	}
+}
+
+func testHttpSettings(t *testing.T) httpSettings {
+	t.Helper()
+
+	settings, err := loadHttpSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return settings
+}
+
+func TestSendRequestRetriesTransientFailures(t *testing.T) {
+	_, sleeps := setupTestEnvironment(t, "http: {retries: 3}\n")
+	server := newRecordingServer(t, status(http.StatusBadGateway, nil), status(http.StatusInternalServerError, nil), body("ok", nil))
+
+	settings := testHttpSettings(t)
+	response, err := sendRequest(settings, settings.client(settings.timeout), server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	if response.StatusCode != http.StatusOK || len(server.requests) != 3 || len(*sleeps) != 2 {
+		t.Errorf("expected 3 requests and 2 backoffs, got status %d after %d requests and %d sleeps", response.StatusCode, len(server.requests), len(*sleeps))
+	}
+	for i, d := range *sleeps {
+		if d < httpBackoffBase<<uint(i)/2 || d > httpBackoffBase<<uint(i) {
+			t.Errorf("backoff %d of %s is outside the jitter range", i, d)
+		}
+	}
+}
+
+func TestSendRequestGivesUpAfterRetries(t *testing.T) {
+	_, sleeps := setupTestEnvironment(t, "http: {retries: 1}\n")
+	server := newRecordingServer(t, status(http.StatusServiceUnavailable, nil))
+
+	settings := testHttpSettings(t)
+	response, err := sendRequest(settings, settings.client(settings.timeout), server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+
+	if response.StatusCode != http.StatusServiceUnavailable || len(server.requests) != 2 || len(*sleeps) != 1 {
+		t.Errorf("expected the last response after 2 requests, got status %d after %d requests", response.StatusCode, len(server.requests))
+	}
+}
+
+func TestSendRequestWaitsForRateLimit(t *testing.T) {
+	_, sleeps := setupTestEnvironment(t, "http: {maxRateLimitWait: 10s}\n")
+	server := newRecordingServer(t,
+		status(http.StatusTooManyRequests, map[string]string{"Retry-After": "3"}),
+		status(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(time.Now().Add(5*time.Second).Unix(), 10)}),
+		body("ok", nil),
+	)
+
+	settings := testHttpSettings(t)
+	response, err := sendRequest(settings, settings.client(settings.timeout), server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+
+	if response.StatusCode != http.StatusOK || len(*sleeps) != 2 {
+		t.Fatalf("expected 2 rate limit waits, got status %d after %d sleeps", response.StatusCode, len(*sleeps))
+	}
+	if (*sleeps)[0] != 3*time.Second {
+		t.Errorf("expected to wait the 3s of Retry-After, waited %s", (*sleeps)[0])
+	}
+	if (*sleeps)[1] <= 3*time.Second || (*sleeps)[1] > 5*time.Second {
+		t.Errorf("expected to wait until the rate limit reset, waited %s", (*sleeps)[1])
+	}
+}
+
+func TestSendRequestFailsOnLongRateLimit(t *testing.T) {
+	_, sleeps := setupTestEnvironment(t, "http: {maxRateLimitWait: 10s}\n")
+	server := newRecordingServer(t, status(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)}))
+
+	settings := testHttpSettings(t)
+	_, err := sendRequest(settings, settings.client(settings.timeout), server.URL, nil)
+	if err == nil || exitCode(err) != ExitCodeCache || !strings.Contains(err.Error(), "rate limited") || !strings.Contains(err.Error(), fluidTokenEnvironmentVariable) {
+		t.Errorf("expected a rate limit error suggesting a token, got %v", err)
+	}
+	if len(*sleeps) != 0 {
+		t.Errorf("expected no wait beyond maxRateLimitWait, slept %v", *sleeps)
+	}
+}
+
+func TestGetJsonRevalidatesWithETag(t *testing.T) {
+	setupTestEnvironment(t, "")
+	server := newRecordingServer(t,
+		body(`{"tag_name": "v1.0.0"}`, map[string]string{"ETag": `"abc"`}),
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") == `"abc"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			_, _ = w.Write([]byte(`{"tag_name": "unexpected"}`))
+		},
+	)
+
+	for i := 0; i < 2; i++ {
+		var release struct {
+			TagName string `json:"tag_name"`
+		}
+		if err := getJson(server.URL+"/releases/latest", &release); err != nil {
+			t.Fatal(err)
+		}
+		if release.TagName != "v1.0.0" {
+			t.Errorf("request %d: expected the cached release, got %q", i, release.TagName)
+		}
+	}
+
+	if len(server.requests) != 2 || server.requests[0].Header.Get("If-None-Match") != "" || server.requests[1].Header.Get("If-None-Match") != `"abc"` {
+		t.Errorf("expected the second request to revalidate the cached response")
+	}
+}
+
+func TestTokenIsOnlySentToTokenHosts(t *testing.T) {
+	tokenHost := newRecordingServer(t, body(`{}`, nil))
+	otherHost := newRecordingServer(t, body("tarball", nil))
+
+	setupTestEnvironment(t, "templates:\n  api:\n    baseUrl: "+tokenHost.URL+"\n")
+	t.Setenv(githubTokenEnvironmentVariable, "github-token")
+	t.Setenv(fluidTokenEnvironmentVariable, "fluid-token")
+
+	var model struct{}
+	if err := getJson(tokenHost.URL+"/repos/go-uniform/base-api/releases/latest", &model); err != nil {
+		t.Fatal(err)
+	}
+	stream, err := getDownloadStream(otherHost.URL + "/tarball")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(stream)
+	_ = stream.Close()
+
+	if got := tokenHost.requests[0].Header.Get("Authorization"); got != "Bearer fluid-token" {
+		t.Errorf("expected FLUID_TOKEN to be sent to the github source, got %q", got)
+	}
+	if got := otherHost.requests[0].Header.Get("Authorization"); got != "" || string(data) != "tarball" {
+		t.Errorf("expected no token to be sent to other hosts, got %q", got)
+	}
+}
+
+func TestHttpConfigValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		error  string
+	}{
+		{"bad timeout", "http: {timeout: soon}\n", "http timeout 'soon' is not a valid duration"},
+		{"negative retries", "http: {retries: -1}\n", "http retries may not be negative"},
+		{"bad proxy", "http: {proxy: 'not a url'}\n", "http proxy 'not a url' is not a valid url"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupTestEnvironment(t, test.config)
+			_, err := loadHttpSettings()
+			if err == nil || !strings.Contains(err.Error(), test.error) || exitCode(err) != ExitCodeValidation {
+				t.Errorf("expected a validation error containing %q, got %v", test.error, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-fluid/fluid"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// rootSchema is a project schema that may pull entities, contracts and portals in from other files
+type rootSchema struct {
+	schemaProject
+	Include *SchemaIncludes `json:"include,omitempty"`
+}
+
+// SchemaIncludes lists glob patterns (relative to the root schema) of files holding a single entity, contract or portal each
+type SchemaIncludes struct {
+	Entities  []string `json:"entities,omitempty"`
+	Contracts []string `json:"contracts,omitempty"`
+	Portals   []string `json:"portals,omitempty"`
+}
+
+// schemaSources tracks which file each schema key was first defined in so duplicates can name both files
+type schemaSources map[string]string
+
+func (s schemaSources) add(kind, key, source string) error {
+	id := fmt.Sprintf("%s:%s", kind, key)
+	if existing, ok := s[id]; ok {
+		if existing == source {
+			return validationError(fmt.Errorf("%s: %s '%s' is defined more than once", source, kind, key))
+		}
+		return validationError(fmt.Errorf("%s: %s '%s' is already defined in %s", source, kind, key, existing))
+	}
+	s[id] = source
+	return nil
+}
+
+// SchemaDocument is a composed project schema along with the files each of its entities, contracts and portals came from
+type SchemaDocument struct {
+	Project    fluid.Project
+	Extensions ProjectExtensions
+
+	root    schemaFile
+	origins map[string]schemaOrigin // keyed by the json pointer of the item in the composed project
+}
+
+type schemaFile struct {
+	Path   string
+	Format string
+	Data   []byte
+}
+
+// schemaOrigin locates an item of the composed project within the file it was defined in
+type schemaOrigin struct {
+	File    schemaFile
+	Pointer string
+}
+
+func (d *SchemaDocument) add(collection string, origin schemaOrigin, index int) {
+	if d.origins == nil {
+		d.origins = map[string]schemaOrigin{}
+	}
+	d.origins[fmt.Sprintf("/%s/%d", collection, index)] = origin
+}
+
+var composeSchema = func(root schemaFile, directory string, schema rootSchema) (*SchemaDocument, error) {
+	document := &SchemaDocument{
+		Project:    schema.Project,
+		Extensions: ProjectExtensions{},
+		root:       root,
+	}
+	sources := schemaSources{}
+
+	document.Project.Entities = nil
+	for i, entity := range schema.Entities {
+		if err := addEntity(document, sources, schemaOrigin{File: root, Pointer: fmt.Sprintf("/entities/%d", i)}, entity); err != nil {
+			return document, err
+		}
+	}
+
+	document.Project.Contracts = nil
+	for i, contract := range schema.Contracts {
+		if err := addContract(document, sources, schemaOrigin{File: root, Pointer: fmt.Sprintf("/contracts/%d", i)}, contract); err != nil {
+			return document, err
+		}
+	}
+
+	document.Project.Portals = nil
+	for i, portal := range schema.Portals {
+		if err := addPortal(document, sources, schemaOrigin{File: root, Pointer: fmt.Sprintf("/portals/%d", i)}, portal); err != nil {
+			return document, err
+		}
+	}
+
+	if schema.Include == nil {
+		return document, nil
+	}
+
+	if err := includeFiles(directory, schema.Include.Entities, func(file schemaFile) error {
+		var entity schemaEntity
+		if err := decodeSchema(file.Path, file.Format, file.Data, &entity); err != nil {
+			return err
+		}
+		return addEntity(document, sources, schemaOrigin{File: file}, entity)
+	}); err != nil {
+		return document, err
+	}
+
+	if err := includeFiles(directory, schema.Include.Contracts, func(file schemaFile) error {
+		var contract fluid.Contract
+		if err := decodeSchema(file.Path, file.Format, file.Data, &contract); err != nil {
+			return err
+		}
+		return addContract(document, sources, schemaOrigin{File: file}, contract)
+	}); err != nil {
+		return document, err
+	}
+
+	if err := includeFiles(directory, schema.Include.Portals, func(file schemaFile) error {
+		var portal fluid.Portal
+		if err := decodeSchema(file.Path, file.Format, file.Data, &portal); err != nil {
+			return err
+		}
+		return addPortal(document, sources, schemaOrigin{File: file}, portal)
+	}); err != nil {
+		return document, err
+	}
+
+	return document, nil
+}
+
+func addEntity(document *SchemaDocument, sources schemaSources, origin schemaOrigin, entity schemaEntity) error {
+	if err := sources.add("entity", entityKey(entity.Entity), origin.File.Path); err != nil {
+		return err
+	}
+	document.add("entities", origin, len(document.Project.Entities))
+	document.Project.Entities = append(document.Project.Entities, entity.Entity)
+	if !entity.EntityExtension.isEmpty() {
+		document.Extensions[entityKey(entity.Entity)] = entity.EntityExtension
+	}
+	return nil
+}
+
+func addContract(document *SchemaDocument, sources schemaSources, origin schemaOrigin, contract fluid.Contract) error {
+	if err := sources.add("contract", contract.Key, origin.File.Path); err != nil {
+		return err
+	}
+	document.add("contracts", origin, len(document.Project.Contracts))
+	document.Project.Contracts = append(document.Project.Contracts, contract)
+	return nil
+}
+
+func addPortal(document *SchemaDocument, sources schemaSources, origin schemaOrigin, portal fluid.Portal) error {
+	if err := sources.add("portal", kebabCase(portal.Name), origin.File.Path); err != nil {
+		return err
+	}
+	document.add("portals", origin, len(document.Project.Portals))
+	document.Project.Portals = append(document.Project.Portals, portal)
+	return nil
+}
+
+// includeFiles expands the glob patterns in order, each file is only included once even if matched by several patterns
+func includeFiles(directory string, patterns []string, include func(file schemaFile) error) error {
+	included := map[string]bool{}
+
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(directory, pattern)
+		}
+
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return validationError(fmt.Errorf("include pattern '%s': %w", pattern, err))
+		}
+
+		if len(paths) <= 0 {
+			return validationError(fmt.Errorf("include pattern '%s' did not match any files", pattern))
+		}
+
+		sort.Strings(paths)
+		for _, path := range paths {
+			if included[path] {
+				continue
+			}
+			included[path] = true
+
+			format, err := schemaFormat(path, "")
+			if err != nil {
+				return err
+			}
+
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return ioError(err)
+			}
+
+			if err := include(schemaFile{Path: path, Format: format, Data: data}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-fluid/fluid"
+	"sort"
+	"strings"
+)
+
+// LintRule is an opinionated check on a project schema that goes beyond structural validation
+type LintRule struct {
+	Name        string
+	Description string
+	Severity    string
+	Check       func(project fluid.Project) []Diagnostic
+}
+
+// LintConfig overrides the severity of lint rules, a severity of "off" disables the rule
+type LintConfig struct {
+	Rules map[string]string `json:"rules,omitempty"`
+}
+
+const SeverityOff = "off"
+
+// typeScriptReservedWords may not name a binding in an es module, which is strict mode code
+var typeScriptReservedWords = []string{
+	"break", "case", "catch", "class", "const", "continue", "debugger", "default", "delete", "do", "else", "enum", "export",
+	"extends", "false", "finally", "for", "function", "if", "implements", "import", "in", "instanceof", "interface", "let",
+	"new", "null", "package", "private", "protected", "public", "return", "static", "super", "switch", "this", "throw",
+	"true", "try", "typeof", "var", "void", "while", "with", "yield", "await",
+}
+
+var lintRules = []LintRule{
+	{
+		Name:        "plural-equals-singular",
+		Description: "entity plural name must differ from its singular name",
+		Severity:    SeverityWarning,
+		Check: func(project fluid.Project) (diagnostics []Diagnostic) {
+			for i, entity := range project.Entities {
+				if kebabCase(entity.NamePlural) == kebabCase(entity.NameSingular) {
+					diagnostics = append(diagnostics, Diagnostic{
+						Path:    fmt.Sprintf("/entities/%d/namePlural", i),
+						Message: fmt.Sprintf("plural name '%s' is the same as the singular name, collection and record names will clash", entity.NamePlural),
+					})
+				}
+			}
+			return
+		},
+	},
+	{
+		Name:        "missing-description",
+		Description: "fields and actions should have a meaningful description",
+		Severity:    SeverityWarning,
+		Check: func(project fluid.Project) (diagnostics []Diagnostic) {
+			for i, entity := range project.Entities {
+				for j, field := range entity.Fields {
+					if strings.TrimSpace(field.Description) == "" {
+						diagnostics = append(diagnostics, Diagnostic{
+							Path:    fmt.Sprintf("/entities/%d/fields/%d/description", i, j),
+							Message: fmt.Sprintf("field '%s' of entity '%s' has no description", field.Name, entity.NameSingular),
+						})
+					}
+				}
+				for j, action := range entity.Actions {
+					if strings.TrimSpace(action.Description) == "" {
+						diagnostics = append(diagnostics, Diagnostic{
+							Path:    fmt.Sprintf("/entities/%d/actions/%d/description", i, j),
+							Message: fmt.Sprintf("action '%s' of entity '%s' has no description", action.Name, entity.NameSingular),
+						})
+					}
+				}
+			}
+			for i, contract := range project.Contracts {
+				for j, field := range contract.Fields {
+					if strings.TrimSpace(field.Description) == "" {
+						diagnostics = append(diagnostics, Diagnostic{
+							Path:    fmt.Sprintf("/contracts/%d/fields/%d/description", i, j),
+							Message: fmt.Sprintf("field '%s' of contract '%s' has no description", field.Name, contract.Key),
+						})
+					}
+				}
+			}
+			return
+		},
+	},
+	{
+		Name:        "duplicate-field-name",
+		Description: "field names must stay unique once converted to camelCase and snake_case",
+		Severity:    SeverityError,
+		Check: func(project fluid.Project) (diagnostics []Diagnostic) {
+			for i, entity := range project.Entities {
+				names := make([]string, len(entity.Fields))
+				for j, field := range entity.Fields {
+					names[j] = field.Name
+				}
+				for _, duplicate := range duplicateNames(names, camelCase, snakeCase) {
+					diagnostics = append(diagnostics, Diagnostic{
+						Path:    fmt.Sprintf("/entities/%d/fields/%d/name", i, duplicate[1]),
+						Message: fmt.Sprintf("field '%s' of entity '%s' clashes with field '%s' once normalised", names[duplicate[1]], entity.NameSingular, names[duplicate[0]]),
+					})
+				}
+			}
+			for i, contract := range project.Contracts {
+				names := make([]string, len(contract.Fields))
+				for j, field := range contract.Fields {
+					names[j] = field.Name
+				}
+				for _, duplicate := range duplicateNames(names, camelCase, snakeCase) {
+					diagnostics = append(diagnostics, Diagnostic{
+						Path:    fmt.Sprintf("/contracts/%d/fields/%d/name", i, duplicate[1]),
+						Message: fmt.Sprintf("field '%s' of contract '%s' clashes with field '%s' once normalised", names[duplicate[1]], contract.Key, names[duplicate[0]]),
+					})
+				}
+			}
+			return
+		},
+	},
+	{
+		Name:        "entity-name-collision",
+		Description: "entity names must stay unique once converted to kebab-case",
+		Severity:    SeverityError,
+		Check: func(project fluid.Project) (diagnostics []Diagnostic) {
+			seen := map[string]string{}
+			for i, entity := range project.Entities {
+				for _, name := range []struct {
+					key   string
+					value string
+				}{
+					{"nameSingular", entity.NameSingular},
+					{"namePlural", entity.NamePlural},
+				} {
+					slug := kebabCase(name.value)
+					// a matching singular and plural on the same entity is reported by plural-equals-singular instead
+					if slug == "" || name.key == "namePlural" && slug == kebabCase(entity.NameSingular) {
+						continue
+					}
+					if existing, ok := seen[slug]; ok {
+						diagnostics = append(diagnostics, Diagnostic{
+							Path:    fmt.Sprintf("/entities/%d/%s", i, name.key),
+							Message: fmt.Sprintf("entity name '%s' collides with '%s' as '%s'", name.value, existing, slug),
+						})
+						continue
+					}
+					seen[slug] = name.value
+				}
+			}
+			return
+		},
+	},
+	{
+		Name:        "reserved-word",
+		Description: "entity plural names must not be typescript reserved words once converted to camelCase, the portal exports each repository under it",
+		Severity:    SeverityError,
+		Check: func(project fluid.Project) (diagnostics []Diagnostic) {
+			// go identifiers and typescript property names generated from a name are never bare reserved words
+			for i, entity := range project.Entities {
+				if message := reservedWordMessage(entity.NamePlural); message != "" {
+					diagnostics = append(diagnostics, Diagnostic{
+						Path:    fmt.Sprintf("/entities/%d/namePlural", i),
+						Message: fmt.Sprintf("entity name %s", message),
+					})
+				}
+			}
+			return
+		},
+	},
+	{
+		Name:        "audit-field-name",
+		Description: "fields must not clash with the implicit createdAt, modifiedAt, deletedAt and login tracking fields",
+		Severity:    SeverityError,
+		Check: func(project fluid.Project) (diagnostics []Diagnostic) {
+			for i, entity := range project.Entities {
+				for j, field := range entity.Fields {
+					if isAuditFieldName(field.Name, entityAuditFieldNames(entity)) {
+						diagnostics = append(diagnostics, Diagnostic{
+							Path:    fmt.Sprintf("/entities/%d/fields/%d/name", i, j),
+							Message: fmt.Sprintf("field '%s' of entity '%s' clashes with the implicit '%s' audit field", field.Name, entity.NameSingular, camelCase(field.Name)),
+						})
+					}
+				}
+			}
+			for i, contract := range project.Contracts {
+				if len(contractAuditFields(contract)) <= 0 {
+					continue
+				}
+				for j, field := range contract.Fields {
+					if isAuditFieldName(field.Name, contractAuditFieldNames(contract)) {
+						diagnostics = append(diagnostics, Diagnostic{
+							Path:    fmt.Sprintf("/contracts/%d/fields/%d/name", i, j),
+							Message: fmt.Sprintf("field '%s' of contract '%s' clashes with the implicit '%s' audit field", field.Name, contract.Key, camelCase(field.Name)),
+						})
+					}
+				}
+			}
+			return
+		},
+	},
+	{
+		Name:        "mixed-groups",
+		Description: "either all or none of an entity's fields should have a group",
+		Severity:    SeverityWarning,
+		Check: func(project fluid.Project) (diagnostics []Diagnostic) {
+			for i, entity := range project.Entities {
+				grouped := 0
+				for _, field := range entity.Fields {
+					if strings.TrimSpace(field.Group) != "" {
+						grouped++
+					}
+				}
+				if grouped <= 0 || grouped == len(entity.Fields) {
+					continue
+				}
+				for j, field := range entity.Fields {
+					if strings.TrimSpace(field.Group) == "" {
+						diagnostics = append(diagnostics, Diagnostic{
+							Path:    fmt.Sprintf("/entities/%d/fields/%d", i, j),
+							Message: fmt.Sprintf("field '%s' of entity '%s' has no group while other fields do and will be placed in the '%s' section", field.Name, entity.NameSingular, defaultSectionTitle),
+						})
+					}
+				}
+			}
+			return
+		},
+	},
+}
+
+// duplicateNames returns index pairs (first, duplicate) of names that are equal under any of the normalisers
+func duplicateNames(names []string, normalisers ...func(string) string) (duplicates [][2]int) {
+	for j := range names {
+		for i := 0; i < j; i++ {
+			clash := false
+			for _, normalise := range normalisers {
+				if normalise(names[i]) == normalise(names[j]) {
+					clash = true
+					break
+				}
+			}
+			if clash {
+				duplicates = append(duplicates, [2]int{i, j})
+				break
+			}
+		}
+	}
+	return
+}
+
+func reservedWordMessage(name string) string {
+	word := camelCase(name)
+	for _, reserved := range typeScriptReservedWords {
+		if reserved == word {
+			return fmt.Sprintf("'%s' becomes '%s' which is a reserved word in typescript", name, word)
+		}
+	}
+	return ""
+}
+
+func findLintRule(name string) (LintRule, bool) {
+	for _, rule := range lintRules {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+	return LintRule{}, false
+}
+
+// validate ensures the config only names known rules and severities
+func (c LintConfig) validate() error {
+	names := make([]string, 0, len(c.Rules))
+	for name := range c.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := findLintRule(name); !ok {
+			return fmt.Errorf("lint rule '%s' does not exist", name)
+		}
+		switch c.Rules[name] {
+		case SeverityOff, SeverityInfo, SeverityWarning, SeverityError:
+		default:
+			return fmt.Errorf("lint rule '%s' has invalid severity '%s', expected one of: off, info, warning, error", name, c.Rules[name])
+		}
+	}
+
+	return nil
+}
+
+var lintDocument = func(document *SchemaDocument, config LintConfig) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for _, rule := range lintRules {
+		severity := rule.Severity
+		if override, ok := config.Rules[rule.Name]; ok {
+			severity = override
+		}
+		if severity == SeverityOff {
+			continue
+		}
+
+		for _, diagnostic := range rule.Check(document.Project) {
+			diagnostic.Rule = rule.Name
+			diagnostic.Severity = severity
+			diagnostics = append(diagnostics, document.locate(diagnostic))
+		}
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-fluid/fluid"
+	"regexp"
+	"strings"
+)
+
+const (
+	ListAlignStart  = "start"
+	ListAlignCenter = "center"
+	ListAlignEnd    = "end"
+)
+
+// listAlignments maps list column alignments to the portal header alignment
+var listAlignments = map[string]string{
+	ListAlignStart:  "EnumHeaderAlign.Start",
+	ListAlignCenter: "EnumHeaderAlign.Center",
+	ListAlignEnd:    "EnumHeaderAlign.End",
+}
+
+var listWidthPattern = regexp.MustCompile(`^\d+(\.\d+)?(px|%|rem|em)?$`)
+
+// ListColumn overrides how a field, link or audit field of an entity is shown in the portal list, unset values keep their defaults
+type ListColumn struct {
+	Field    string    `json:"field"`
+	Visible  *bool     `json:"visible,omitempty"`
+	Align    string    `json:"align,omitempty"`
+	Sortable *bool     `json:"sortable,omitempty"`
+	Width    ListWidth `json:"width,omitempty"`
+}
+
+// ListWidth is a css width, plain numbers are pixels and may be written without quotes
+type ListWidth string
+
+func (w *ListWidth) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err == nil {
+		*w = ListWidth(number)
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*w = ListWidth(value)
+	return nil
+}
+
+func (e EntityExtension) listColumn(name string) *ListColumn {
+	for i, column := range e.List {
+		if camelCase(column.Field) == camelCase(name) {
+			return &e.List[i]
+		}
+	}
+	return nil
+}
+
+// portalHeader is a column of a portal list
+type portalHeader struct {
+	Key      string
+	Align    string
+	Sortable bool
+	Width    string
+	visible  bool
+}
+
+// defaultListAlign right aligns numbers and centers booleans so list columns read like a spreadsheet
+func defaultListAlign(fieldType string) string {
+	switch strings.ToLower(fieldType) {
+	case fluid.EntityFieldTypeInteger, fluid.EntityFieldTypeDecimal, fluid.EntityFieldTypeMoney:
+		return ListAlignEnd
+	case fluid.EntityFieldTypeBoolean:
+		return ListAlignCenter
+	}
+	return ListAlignStart
+}
+
+func isSortableFieldType(fieldType string) bool {
+	switch strings.ToLower(fieldType) {
+	case fluid.EntityFieldTypePassword, fluid.EntityFieldTypeBinary, fluid.EntityFieldTypeAttribute:
+		return false
+	}
+	return true
+}
+
+func applyListColumn(header portalHeader, column *ListColumn) portalHeader {
+	if column == nil {
+		return header
+	}
+	if column.Visible != nil {
+		header.visible = *column.Visible
+	}
+	if column.Align != "" {
+		header.Align = column.Align
+	}
+	if column.Sortable != nil {
+		header.Sortable = *column.Sortable
+	}
+	if column.Width != "" {
+		header.Width = string(column.Width)
+		if strings.Trim(header.Width, "0123456789.") == "" {
+			header.Width += "px"
+		}
+	}
+	return header
+}
+
+// entityHeaders returns the visible list columns of an entity in schema order, fields first followed by links and audit fields
+func entityHeaders(entity fluid.Entity, extension EntityExtension, links []resolvedLink) []portalHeader {
+	var headers []portalHeader
+
+	add := func(name string, header portalHeader) {
+		header.Key = camelCase(name)
+		header = applyListColumn(header, extension.listColumn(name))
+		header.Align = listAlignments[header.Align]
+		if header.visible {
+			headers = append(headers, header)
+		}
+	}
+
+	for _, field := range entity.Fields {
+		add(field.Name, portalHeader{
+			Align:    defaultListAlign(field.Type),
+			Sortable: !field.NotSortable && !field.EnableMultipleValueSupport && isSortableFieldType(field.Type),
+			visible:  !field.NotHeader && strings.ToLower(field.Type) != fluid.EntityFieldTypePassword,
+		})
+	}
+
+	for _, link := range links {
+		add(link.Name, portalHeader{
+			Align:    ListAlignStart,
+			Sortable: !link.IsMultiple(),
+			visible:  true,
+		})
+	}
+
+	for _, field := range entityAuditFields(entity) {
+		add(field.Name, portalHeader{
+			Align:    ListAlignEnd,
+			Sortable: true,
+			visible:  !field.NotHeader,
+		})
+	}
+
+	return headers
+}
+
+// portalAction is an action on the records of a portal list, actions with a path call the api
+type portalAction struct {
+	Key      string
+	Title    string
+	Icon     string
+	Color    string
+	Method   string
+	Path     string
+	Download bool
+}
+
+// entityBulkActions returns delete, unless the entity disables it, followed by the entity's list actions
+func entityBulkActions(entity fluid.Entity) []portalAction {
+	var actions []portalAction
+
+	if !entity.DisableDelete {
+		actions = append(actions, portalAction{
+			Key:   "delete",
+			Title: "$vuetify.entityList.delete",
+			Icon:  "mdi-delete",
+			Color: "error",
+		})
+	}
+
+	for _, action := range entity.Actions {
+		if strings.ToLower(action.Type) != fluid.EntityActionTypeList {
+			continue
+		}
+		actions = append(actions, newPortalAction(entity, action))
+	}
+
+	return actions
+}
+
+// entityRecordActions returns the record actions of an entity, shown as buttons on each record
+func entityRecordActions(entity fluid.Entity) []portalAction {
+	var actions []portalAction
+
+	for _, action := range entity.Actions {
+		if strings.ToLower(action.Type) != fluid.EntityActionTypeRecord {
+			continue
+		}
+		actions = append(actions, newPortalAction(entity, action))
+	}
+
+	return actions
+}
+
+func newPortalAction(entity fluid.Entity, action fluid.EntityAction) portalAction {
+	icon := "mdi-play"
+	if action.EnableFileDownloadResponse {
+		icon = "mdi-download"
+	}
+	return portalAction{
+		Key:      kebabCase(action.Name),
+		Title:    titleCase(action.Name),
+		Icon:     icon,
+		Color:    "primary",
+		Method:   strings.ToUpper(action.Method),
+		Path:     entityActionPath(entity, action),
+		Download: action.EnableFileDownloadResponse,
+	}
+}
+
+func validateListColumns(project fluid.Project, extensions ProjectExtensions) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for i, entity := range project.Entities {
+		extension := extensions.entity(entity)
+
+		names := map[string]bool{}
+		for _, name := range entityFieldNames(entity) {
+			names[camelCase(name)] = true
+		}
+		for _, link := range extension.Links {
+			names[camelCase(link.Name)] = true
+		}
+		for _, field := range entityAuditFields(entity) {
+			names[camelCase(field.Name)] = true
+		}
+
+		columns := map[string]bool{}
+		for j, column := range extension.List {
+			pointer := fmt.Sprintf("/entities/%d/list/%d", i, j)
+
+			if strings.TrimSpace(column.Field) == "" {
+				diagnostics = append(diagnostics, Diagnostic{Path: pointer + "/field", Severity: SeverityError, Message: "is required"})
+			} else if !names[camelCase(column.Field)] {
+				diagnostics = append(diagnostics, Diagnostic{Path: pointer + "/field", Severity: SeverityError, Message: fmt.Sprintf("entity '%s' has no field, link or audit field '%s'", entity.NameSingular, column.Field)})
+			} else if columns[camelCase(column.Field)] {
+				diagnostics = append(diagnostics, Diagnostic{Path: pointer + "/field", Severity: SeverityError, Message: fmt.Sprintf("list settings for '%s' are defined more than once", column.Field)})
+			}
+			columns[camelCase(column.Field)] = true
+
+			if _, ok := listAlignments[column.Align]; column.Align != "" && !ok {
+				diagnostics = append(diagnostics, Diagnostic{
+					Path:     pointer + "/align",
+					Severity: SeverityError,
+					Message:  fmt.Sprintf("'%s' is not a valid alignment, expected one of: %s, %s, %s", column.Align, ListAlignStart, ListAlignCenter, ListAlignEnd),
+				})
+			}
+
+			if column.Width != "" && !listWidthPattern.MatchString(string(column.Width)) {
+				diagnostics = append(diagnostics, Diagnostic{Path: pointer + "/width", Severity: SeverityError, Message: fmt.Sprintf("'%s' is not a valid width, expected a number of px, %%, rem or em", column.Width)})
+			}
+		}
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// lockFileName is the file pinning the base template releases of a project, it lives next to the schema
+const lockFileName = "fluid.lock"
+
+// TemplateLock pins a base template to a release, Digest is the sha256 of the release tarball
+type TemplateLock struct {
+	Name       string `json:"name"`
+	Tag        string `json:"tag"`
+	TarballUrl string `json:"tarballUrl"`
+	Digest     string `json:"digest"`
+}
+
+// LockFile records the base template releases a project is built from
+type LockFile struct {
+	Templates []TemplateLock `json:"templates"`
+}
+
+func (l LockFile) template(name string) (TemplateLock, bool) {
+	for _, template := range l.Templates {
+		if template.Name == name {
+			return template, true
+		}
+	}
+	return TemplateLock{}, false
+}
+
+// set adds or replaces the lock of a template, templates are kept sorted by name so the file diffs cleanly
+func (l *LockFile) set(template TemplateLock) {
+	for i := range l.Templates {
+		if l.Templates[i].Name == template.Name {
+			l.Templates[i] = template
+			return
+		}
+	}
+	l.Templates = append(l.Templates, template)
+	sort.Slice(l.Templates, func(i, j int) bool {
+		return l.Templates[i].Name < l.Templates[j].Name
+	})
+}
+
+// defaultLockPath places the lock file next to the schema, or in the working directory for stdin and the built-in schema
+func defaultLockPath(schemaPath string) string {
+	if schemaPath == "" || schemaPath == "-" {
+		return lockFileName
+	}
+	return filepath.Join(filepath.Dir(schemaPath), lockFileName)
+}
+
+// readLockFile returns nil without an error when the lock file does not exist
+var readLockFile = func(path string) (*LockFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, ioError(err)
+	}
+
+	var lock LockFile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, validationError(fmt.Errorf("%s: %w", path, err))
+	}
+
+	for _, template := range lock.Templates {
+		if strings.TrimSpace(template.Name) == "" || strings.TrimSpace(template.Tag) == "" || strings.TrimSpace(template.TarballUrl) == "" || !strings.HasPrefix(template.Digest, digestPrefix) {
+			return nil, validationError(fmt.Errorf("%s: every template needs a name, tag, tarball url and sha256 digest", path))
+		}
+	}
+
+	return &lock, nil
+}
+
+var writeLockFile = func(path string, lock LockFile) error {
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return ioError(err)
+	}
+	return nil
+}
+
+// lockedTemplateDirectories resolves the cache directory of every locked release, with download the releases missing
+// from the cache are fetched and checked against their digest
+var lockedTemplateDirectories = func(lock LockFile, download bool) (map[string]string, error) {
+	templateRepositories, err := getTemplateRepositories()
+	if err != nil {
+		return nil, err
+	}
+
+	directories := map[string]string{}
+	for _, templateRepository := range templateRepositories {
+		if templateRepository.Source.Type == TemplateSourceDirectory {
+			directories[templateRepository.Name] = templateRepository.Source.Path
+			continue
+		}
+
+		locked, ok := lock.template(templateRepository.Name)
+		if !ok {
+			return nil, cacheError(fmt.Errorf("template '%s' is not pinned in %s, run 'fluid cache upgrade' to add it", templateRepository.Name, lockFileName))
+		}
+
+		directory := filepath.Join(templateRepository.CacheDirectory, locked.Tag)
+		if !download {
+			if _, err := os.Stat(directory); err != nil {
+				return nil, cacheError(fmt.Errorf("template '%s': locked release '%s' is not cached, build without -skip-cache-update to download it", locked.Name, locked.Tag))
+			}
+			directories[templateRepository.Name] = directory
+			continue
+		}
+
+		if _, err := cacheRelease(templateRepository, locked.Tag, locked.TarballUrl, locked.Digest); err != nil {
+			return nil, fmt.Errorf("template '%s': %w", templateRepository.Name, err)
+		}
+		directories[templateRepository.Name] = directory
+	}
+
+	return directories, nil
+}
+
+// upgradeLock moves the named templates, or all of them without names, to their latest release
+var upgradeLock = func(lock *LockFile, names []string) ([]string, error) {
+	templateRepositories, err := getTemplateRepositories()
+	if err != nil {
+		return nil, err
+	}
+
+	templateRepositories, err = selectTemplateRepositories(templateRepositories, names)
+	if err != nil {
+		return nil, err
+	}
+
+	var report []string
+	for _, templateRepository := range templateRepositories {
+		if templateRepository.Source.Type == TemplateSourceDirectory {
+			report = append(report, fmt.Sprintf("%s %s (local directory, not locked)", templateRepository.Name, templateRepository.Source.Path))
+			continue
+		}
+
+		release, err := updateCache(templateRepository)
+		if err != nil {
+			return nil, fmt.Errorf("template '%s': %w", templateRepository.Name, err)
+		}
+
+		previous, ok := lock.template(templateRepository.Name)
+		switch {
+		case !ok:
+			report = append(report, fmt.Sprintf("%s %s (added)", release.Name, release.Tag))
+		case previous.Tag != release.Tag:
+			report = append(report, fmt.Sprintf("%s %s -> %s", release.Name, previous.Tag, release.Tag))
+		default:
+			report = append(report, fmt.Sprintf("%s %s (unchanged)", release.Name, release.Tag))
+		}
+		lock.set(release)
+	}
+
+	if len(report) <= 0 {
+		return nil, errors.New("no templates to upgrade")
+	}
+	return report, nil
+}
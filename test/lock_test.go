@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCacheReleaseRejectsDigestMismatch(t *testing.T) {
+	tarball := testTarball(t, map[string]string{"go.mod": "module logic\n"})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(tarball)
+	}))
+	defer server.Close()
+
+	setupTestEnvironment(t, "")
+	templateRepository := testTemplateRepository(t, "logic")
+
+	_, err := cacheRelease(templateRepository, "v1.0.0", server.URL+"/v1.0.0", digestPrefix+strings.Repeat("0", 64))
+	if err == nil || exitCode(err) != ExitCodeCache || !strings.Contains(err.Error(), "does not match the locked digest") {
+		t.Fatalf("expected a digest mismatch, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(templateRepository.CacheDirectory, "v1.0.0")); !os.IsNotExist(err) {
+		t.Errorf("a release with the wrong digest was extracted")
+	}
+
+	digest, err := cacheRelease(templateRepository, "v1.0.1", server.URL+"/v1.0.1", testDigest(tarball))
+	if err != nil || digest != testDigest(tarball) {
+		t.Errorf("expected the locked digest to be accepted, got %s, %v", digest, err)
+	}
+}
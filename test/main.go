@@ -2,18 +2,23 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/go-fluid/fluid"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 	"text/template"
-	"time"
 )
 
 const (
@@ -23,30 +28,52 @@ const (
 	BasePortalVuetifyLatestReleaseInfo = "https://api.github.com/repos/go-fluid/base-portal-vuetify/releases/latest"
 )
 
-var buildProject = func(project fluid.Project, directory string, archiveOutput bool) {
-	if errs := project.Validate(); errs != nil {
-		panic(errs.Error())
+// BuildOptions controls how buildProject writes the generated project
+type BuildOptions struct {
+	Archive bool // write a .tar.gz archive instead of merging into the output directory
+	DryRun  bool // only report the files that would be created, modified or deleted
+	Diff    bool // only print unified diffs of the output directory against the generated files
+
+	Templates map[string]string // base template directories by template name, templates missing here use their latest release
+}
+
+var buildProject = func(project fluid.Project, extensions ProjectExtensions, directory string, options BuildOptions) error {
+	if errs := validateProject(project); errs != nil {
+		return validationError(errs)
 	}
 
-	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
-		panic(err)
+	if diagnostics := append(validateFieldOptions(project), validateExtensions(project, extensions)...); len(diagnostics) > 0 {
+		return validationError(fmt.Errorf("%s", diagnostics[0]))
+	}
+
+	if !options.DryRun && !options.Diff {
+		if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+			return ioError(err)
+		}
 	}
 
 	projectSlug := kebabCase(project.Name)
 	temporaryDirectory, err := ioutil.TempDir("", "*")
 
 	if err != nil {
-		panic(err)
+		return ioError(err)
 	}
 
+	defer func() { _ = os.RemoveAll(temporaryDirectory) }()
+
 	projectDirectory := filepath.Join(temporaryDirectory, projectSlug)
 
 	if err := os.MkdirAll(projectDirectory, os.ModePerm); err != nil {
-		panic(err)
+		return ioError(err)
 	}
 
-	buildApi(project, projectDirectory)
-	buildLogic(project, projectDirectory)
+	if err := buildApi(project, extensions, options.Templates, projectDirectory); err != nil {
+		return fmt.Errorf("api: %w", err)
+	}
+
+	if err := buildLogic(project, extensions, options.Templates, projectDirectory); err != nil {
+		return fmt.Errorf("logic: %w", err)
+	}
 
 	for _, portal := range project.Portals {
 
@@ -56,596 +83,1043 @@ var buildProject = func(project fluid.Project, directory string, archiveOutput b
 
 		switch portal.Type {
 		case fluid.PortalTypeIonic:
-			buildPortalIonic(portal, projectDirectory)
+			if err := buildPortalIonic(portal, options.Templates, projectDirectory); err != nil {
+				return fmt.Errorf("portal '%s': %w", portal.Name, err)
+			}
 			portalRepositoriesBaseDirectory = filepath.Join(portalDirectory, "src", "services", "repositories")
 		case fluid.PortalTypeVuetify:
-			buildPortalVuetify(portal, projectDirectory)
+			if err := buildPortalVuetify(portal, options.Templates, projectDirectory); err != nil {
+				return fmt.Errorf("portal '%s': %w", portal.Name, err)
+			}
 			portalRepositoriesBaseDirectory = filepath.Join(portalDirectory, "src", "services", "repositories")
 		default:
-			panic(fmt.Sprintf("portal type '%s' not supported", portal.Type))
+			return validationError(fmt.Errorf("portal '%s': portal type '%s' not supported", portal.Name, portal.Type))
 		}
 
 		if err := os.MkdirAll(portalRepositoriesBaseDirectory, os.ModePerm); err != nil {
-			panic(err)
+			return ioError(fmt.Errorf("portal '%s': %w", portal.Name, err))
 		}
 
 		for _, entity := range project.Entities {
-			buildRepositoryFile(entity, portalRepositoriesBaseDirectory)
+			if err := buildRepositoryFile(project, extensions, entity, portalRepositoriesBaseDirectory); err != nil {
+				return fmt.Errorf("portal '%s': %w", portal.Name, err)
+			}
+		}
+
+		if err := buildPermissionsFile(project, extensions, portal, portalRepositoriesBaseDirectory); err != nil {
+			return fmt.Errorf("portal '%s': %w", portal.Name, err)
 		}
 
 	}
 
 	projectVersionedName := fmt.Sprintf("%s-%s", projectSlug, project.Version)
-	fluidDirectory := filepath.Join(temporaryDirectory, "fluid")
-	if archiveOutput {
+	outputDirectory := filepath.Join(directory, projectVersionedName)
+	if options.DryRun || options.Diff {
+		changes, err := planOutput(projectDirectory, outputDirectory)
+		if err != nil {
+			return err
+		}
+		return printOutputPlan(os.Stdout, changes, options.Diff)
+	}
+
+	if options.Archive {
 		projectFile := filepath.Join(directory, fmt.Sprintf("%s.tar.gz", projectVersionedName))
-		cmd := exec.Command("tar", "-czvf", projectFile, "-C", fluidDirectory, ".")
-		fmt.Println(cmd.String())
-		if err := cmd.Run(); err != nil {
-			panic(err)
+		if err := runCommand("tar", "-czvf", projectFile, "-C", projectDirectory, "."); err != nil {
+			return ioError(err)
 		}
 	} else {
-		projectDirectory := filepath.Join(directory, projectVersionedName)
-		cmd := exec.Command("rm", "-rf", projectDirectory)
-		fmt.Println(cmd.String())
-		if err := cmd.Run(); err != nil {
-			panic(err)
+		changes, err := planOutput(projectDirectory, outputDirectory)
+		if err != nil {
+			return err
 		}
-		cmd = exec.Command("cp", "-r", fluidDirectory, projectDirectory)
-		fmt.Println(cmd.String())
-		if err := cmd.Run(); err != nil {
-			panic(err)
+		if err := applyOutput(changes, projectDirectory, outputDirectory); err != nil {
+			return err
+		}
+		if conflicts := printOutputChanges(os.Stdout, changes); conflicts > 0 {
+			return conflictError(fmt.Errorf("%d file(s) in '%s' have conflicts with local changes, resolve them and build again", conflicts, outputDirectory))
 		}
 	}
 
+	return nil
 }
 
-var buildPortalIonic = func(portal fluid.Portal, temporaryDirectory string) {
+var buildPortalIonic = func(portal fluid.Portal, templates map[string]string, temporaryDirectory string) error {
 
 	if portal.Type != fluid.PortalTypeIonic {
-		panic(fmt.Sprintf("invalid portal type '%s' detected", portal.Type))
+		return fmt.Errorf("invalid portal type '%s' detected", portal.Type)
 	}
 
-	templateDirectory := filepath.Join(getCacheDirectory(), "portal-ionic/latest")
+	templateDirectory, err := resolveTemplateDirectory(templates, "portal-ionic")
+	if err != nil {
+		return err
+	}
 	portalSlug := kebabCase(portal.Name)
 	targetDirectory := filepath.Join(temporaryDirectory, portalSlug)
-	copyDirectory(templateDirectory, targetDirectory)
+	return copyDirectory(templateDirectory, targetDirectory)
 
 }
 
-var buildPortalVuetify = func(portal fluid.Portal, temporaryDirectory string) {
+var buildPortalVuetify = func(portal fluid.Portal, templates map[string]string, temporaryDirectory string) error {
 
 	if portal.Type != fluid.PortalTypeVuetify {
-		panic(fmt.Sprintf("invalid portal type '%s' detected", portal.Type))
+		return fmt.Errorf("invalid portal type '%s' detected", portal.Type)
 	}
 
-	templateDirectory := filepath.Join(getCacheDirectory(), "portal-vuetify/latest")
+	templateDirectory, err := resolveTemplateDirectory(templates, "portal-vuetify")
+	if err != nil {
+		return err
+	}
 	portalSlug := kebabCase(portal.Name)
 	targetDirectory := filepath.Join(temporaryDirectory, portalSlug)
-	copyDirectory(templateDirectory, targetDirectory)
+	return copyDirectory(templateDirectory, targetDirectory)
 
 }
 
-var buildApi = func(project fluid.Project, temporaryDirectory string) {
+var buildApi = func(project fluid.Project, extensions ProjectExtensions, templates map[string]string, temporaryDirectory string) error {
 
-	templateDirectory := filepath.Join(getCacheDirectory(), "api/latest")
+	templateDirectory, err := resolveTemplateDirectory(templates, "api")
+	if err != nil {
+		return err
+	}
 	targetDirectory := filepath.Join(temporaryDirectory, "api")
-	copyDirectory(templateDirectory, targetDirectory)
+	if err := copyDirectory(templateDirectory, targetDirectory); err != nil {
+		return err
+	}
 	contractsDirectory := filepath.Join(targetDirectory, "service", "contracts")
 
 	for _, contract := range project.Contracts {
 
-		buildContractFile(contract, contractsDirectory)
+		if err := buildContractFile(contract, contractsDirectory); err != nil {
+			return err
+		}
+
+	}
+
+	if err := buildApiRoutesFile(project, targetDirectory); err != nil {
+		return err
+	}
 
+	if err := runCommand("gofmt", "-s", "-w", contractsDirectory, filepath.Join(targetDirectory, "service", "actions")); err != nil {
+		return err
 	}
 
-	cmd := exec.Command("gofmt", "-s", "-w", contractsDirectory)
-	fmt.Println(cmd.String())
-	if err := cmd.Run(); err != nil {
-		panic(err)
+	if err := writeFluidJson(project, extensions, targetDirectory); err != nil {
+		return err
 	}
 
-	fluidJsonData, err := json.MarshalIndent(project, "", "  ")
+	openApi, err := buildOpenApi(project, extensions)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("openapi: %w", err)
 	}
-	fluidJsonFilePath := filepath.Join(targetDirectory, "fluid.json")
-	if err := ioutil.WriteFile(fluidJsonFilePath, fluidJsonData, os.ModePerm); err != nil {
-		panic(err)
+
+	if err := writeOpenApiJson(openApi, targetDirectory); err != nil {
+		return fmt.Errorf("openapi: %w", err)
+	}
+
+	if err := buildApiDocs(project, openApi, targetDirectory); err != nil {
+		return fmt.Errorf("api docs: %w", err)
 	}
 
-	// todo: generate openapi.json
-	// todo: generate api documentation based on openapi.json
+	return nil
 }
 
-var buildLogic = func(project fluid.Project, temporaryDirectory string) {
+var buildLogic = func(project fluid.Project, extensions ProjectExtensions, templates map[string]string, temporaryDirectory string) error {
 
-	templateDirectory := filepath.Join(getCacheDirectory(), "logic", "latest")
+	templateDirectory, err := resolveTemplateDirectory(templates, "logic")
+	if err != nil {
+		return err
+	}
 	targetDirectory := filepath.Join(temporaryDirectory, "logic")
-	copyDirectory(templateDirectory, targetDirectory)
+	if err := copyDirectory(templateDirectory, targetDirectory); err != nil {
+		return err
+	}
 	entitiesDirectory := filepath.Join(targetDirectory, "service", "entities")
 
 	for _, entity := range project.Entities {
 
-		buildEntityFile(entity, entitiesDirectory)
+		if err := buildEntityFile(entity, extensions.entity(entity), entitiesDirectory); err != nil {
+			return err
+		}
 
 	}
 
-	cmd := exec.Command("gofmt", "-s", "-w", entitiesDirectory)
-	fmt.Println(cmd.String())
-	if err := cmd.Run(); err != nil {
-		panic(err)
+	if hasAttributeConstraints(project, extensions) {
+		if err := buildAttributesFile(entitiesDirectory); err != nil {
+			return err
+		}
+	}
+
+	contractsDirectory := filepath.Join(targetDirectory, "service", "contracts")
+	if err := os.MkdirAll(contractsDirectory, os.ModePerm); err != nil {
+		return ioError(err)
+	}
+
+	for _, contract := range project.Contracts {
+
+		if err := buildContractFile(contract, contractsDirectory); err != nil {
+			return err
+		}
+
 	}
 
-	fluidJsonData, err := json.MarshalIndent(project, "", "  ")
+	if err := buildLogicHandlerFiles(project, targetDirectory); err != nil {
+		return err
+	}
+
+	if err := runCommand("gofmt", "-s", "-w", entitiesDirectory, contractsDirectory, filepath.Join(targetDirectory, "service", "actions")); err != nil {
+		return err
+	}
+
+	return writeFluidJson(project, extensions, targetDirectory)
+}
+
+var writeFluidJson = func(project fluid.Project, extensions ProjectExtensions, directory string) error {
+	fluidJsonData, err := json.MarshalIndent(newSchemaProject(project, extensions), "", "  ")
 	if err != nil {
-		panic(err)
+		return err
 	}
-	fluidJsonFilePath := filepath.Join(targetDirectory, "fluid.json")
+	fluidJsonFilePath := filepath.Join(directory, "fluid.json")
 	if err := ioutil.WriteFile(fluidJsonFilePath, fluidJsonData, os.ModePerm); err != nil {
-		panic(err)
+		return ioError(err)
 	}
+	return nil
 }
 
 const entityFileTemplate = `package entities
-
+{{ Imports }}
 const (
 	Collection{{ .NamePlural | PascalCase }} = "{{ .NamePlural | CamelCase }}"
 )
 
 type {{ .NameSingular | PascalCase }} struct {
 
-{{range .Fields}}    {{ .Name | PascalCase }} {{ .Type }} ` + "`" + `bson:"{{ .Name | FieldCase }}"` + "`" + `
+{{ if not HasIdField }}    Id primitive.ObjectID ` + "`" + `bson:"_id,omitempty" json:"id,omitempty"` + "`" + `
+{{ end }}{{range .Fields}}    {{ .Name | PascalCase }} {{ GoType . }} ` + "`" + `bson:"{{ .Name | FieldCase }}{{ if .IsOptional }},omitempty{{ end }}" json:"{{ .Name | CamelCase }}{{ if .IsOptional }},omitempty{{ end }}"` + "`" + `
+{{end}}{{range Links}}    {{ .Name | PascalCase }} {{ LinkGoType . }} ` + "`" + `bson:"{{ .Name | FieldCase }}{{ if .IsOptional }},omitempty{{ end }}" json:"{{ .Name | CamelCase }}{{ if .IsOptional }},omitempty{{ end }}"` + "`" + `
 {{end}}
+{{range AuditFields}}    {{ .Name | PascalCase }} {{ GoType . }} ` + "`" + `bson:"{{ .Name | FieldCase }}{{ if .IsOptional }},omitempty{{ end }}" json:"{{ .Name | CamelCase }}{{ if .IsOptional }},omitempty{{ end }}"` + "`" + `
+{{end}}
+}
+{{range .Fields}}{{ with AttributeConstraint . }}
+// Validate{{ .Field | PascalCase }}Attributes checks the {{ .Field | CamelCase }} attributes against the schema constraints
+func (e {{ $.NameSingular | PascalCase }}) Validate{{ .Field | PascalCase }}Attributes() error {
+	return validateAttributes("{{ .Field | CamelCase }}", e.{{ .Field | PascalCase }}, map[string]AttributeConstraint{
+{{range .Keys}}		{{ printf "%q" .Key }}: {Type: "{{ .Type }}", IsOptional: {{ .IsOptional }}},
+{{end}}	}, {{ .AllowOtherKeys }})
 }
+{{end}}{{end}}
+// fluid:begin custom
+// fluid:end custom
 `
 
-var buildEntityFile = func(entity fluid.Entity, directory string) {
+var buildEntityFile = func(entity fluid.Entity, extension EntityExtension, directory string) error {
+
+	if err := checkAuditFieldNames("entity", entity.NameSingular, entityFieldNames(entity), entityAuditFieldNames(entity)); err != nil {
+		return err
+	}
 
 	entityFileName := fmt.Sprintf("%s.go", snakeCase(entity.NameSingular))
 	entityFilePath := filepath.Join(strings.TrimSuffix(directory, "entities"), "entities", entityFileName)
 	entityFile, err := os.Create(entityFilePath)
 
 	if err != nil {
-		panic(err)
+		return ioError(fmt.Errorf("entity '%s': %w", entity.NameSingular, err))
 	}
 
 	defer func() { _ = entityFile.Close() }()
 
-	/* todo: add hidden fields
-	- createdAt
-	- modifiedAt
-	- deletedAt
-
-	- lockedAt (if has password field)
-	- loginAt (if has password field)
-	- loginAttempts (if has password field)
-	*/
-	// todo: handle link fields
-	// todo: handle attribute fields
-
-	tmpl := template.Must(
-		template.New(entity.NameSingular).Funcs(
-			template.FuncMap{
-				"FieldCase": func(value string) string {
-					if strings.ToLower(value) == "id" {
-						return "_id"
-					}
-					return camelCase(value)
-				},
-				"SnakeCase":  snakeCase,
-				"CamelCase":  camelCase,
-				"KebabCase":  kebabCase,
-				"TitleCase":  titleCase,
-				"PascalCase": pascalCase,
+	tmpl, err := template.New(entity.NameSingular).Funcs(
+		template.FuncMap{
+			"Imports": func() string {
+				return entityGoImports(entity, extension)
+			},
+			"Links": func() []EntityLink {
+				return extension.Links
+			},
+			"LinkGoType": linkGoType,
+			"AttributeConstraint": func(field fluid.EntityField) *AttributeConstraint {
+				if !isAttributeField(field) {
+					return nil
+				}
+				return extension.attributeConstraint(field)
+			},
+			"HasIdField": func() bool {
+				return hasEntityIdField(entity)
 			},
-		).Parse(
-			entityFileTemplate,
-		),
+			"AuditFields": func() []fluid.EntityField {
+				return entityAuditFields(entity)
+			},
+			"GoType": entityFieldGoType,
+			"FieldCase": func(value string) string {
+				if strings.ToLower(value) == "id" {
+					return "_id"
+				}
+				return camelCase(value)
+			},
+			"SnakeCase":  snakeCase,
+			"CamelCase":  camelCase,
+			"KebabCase":  kebabCase,
+			"TitleCase":  titleCase,
+			"PascalCase": pascalCase,
+		},
+	).Parse(
+		entityFileTemplate,
 	)
+	if err != nil {
+		return fmt.Errorf("entity '%s': parse entity file template: %w", entity.NameSingular, err)
+	}
 
 	if err := tmpl.Execute(
 		entityFile,
 		entity,
 	); err != nil {
-		panic(err)
+		return fmt.Errorf("entity '%s': execute entity file template: %w", entity.NameSingular, err)
 	}
 
+	return nil
 }
 
 const contractFileTemplate = `package contracts
-
+{{ Imports }}
 type {{ .Name | PascalCase }}{{ .Type | PascalCase }} struct {
 
-{{range .Fields}}    {{ .Name | PascalCase }} {{ .Type }} ` + "`" + `bson:"{{ .Name | FieldCase }}"` + "`" + `
+{{range .Fields}}    {{ .Name | PascalCase }} {{ GoType . }} ` + "`" + `bson:"{{ .Name | FieldCase }}" json:"{{ .Name | CamelCase }}"` + "`" + `
+{{end}}
+{{range AuditFields}}    {{ .Name | PascalCase }} {{ AuditGoType . }} ` + "`" + `bson:"{{ .Name | FieldCase }},omitempty" json:"{{ .Name | CamelCase }},omitempty"` + "`" + `
 {{end}}
 }
+
+// fluid:begin custom
+// fluid:end custom
 `
 
-var buildContractFile = func(contract fluid.Contract, directory string) {
+var buildContractFile = func(contract fluid.Contract, directory string) error {
+
+	if len(contractAuditFields(contract)) > 0 {
+		if err := checkAuditFieldNames("contract", contract.Key, contractFieldNames(contract), contractAuditFieldNames(contract)); err != nil {
+			return err
+		}
+	}
 
 	contractFileName := fmt.Sprintf("%s.go", snakeCase(fmt.Sprintf("%s %s", contract.Name, strings.ToTitle(contract.Type))))
 	contractFilePath := filepath.Join(strings.TrimSuffix(directory, "contracts"), "contracts", contractFileName)
 	contractFile, err := os.Create(contractFilePath)
 
 	if err != nil {
-		panic(err)
+		return ioError(fmt.Errorf("contract '%s': %w", contract.Key, err))
 	}
 
 	defer func() { _ = contractFile.Close() }()
 
-	/* todo: add hidden fields
-	- createdAt
-	- modifiedAt
-	- deletedAt
-
-	- lockedAt (if has password field)
-	- loginAt (if has password field)
-	- loginAttempts (if has password field)
-	*/
-	// todo: handle link fields
-	// todo: handle attribute fields
-
-	tmpl := template.Must(
-		template.New(contract.Name).Funcs(
-			template.FuncMap{
-				"FieldCase": func(value string) string {
-					if strings.ToLower(value) == "id" {
-						return "_id"
-					}
-					return camelCase(value)
-				},
-				"SnakeCase":  snakeCase,
-				"CamelCase":  camelCase,
-				"KebabCase":  kebabCase,
-				"TitleCase":  titleCase,
-				"PascalCase": pascalCase,
+	// links and attribute constraints are entity extensions, contracts have neither link nor attribute fields
+
+	tmpl, err := template.New(contract.Name).Funcs(
+		template.FuncMap{
+			"Imports": func() string {
+				return contractGoImports(contract)
+			},
+			"AuditFields": func() []fluid.ContractField {
+				return contractAuditFields(contract)
 			},
-		).Parse(
-			contractFileTemplate,
-		),
+			"AuditGoType": contractAuditFieldGoType,
+			"GoType":      contractFieldGoType,
+			"FieldCase": func(value string) string {
+				if strings.ToLower(value) == "id" {
+					return "_id"
+				}
+				return camelCase(value)
+			},
+			"SnakeCase":  snakeCase,
+			"CamelCase":  camelCase,
+			"KebabCase":  kebabCase,
+			"TitleCase":  titleCase,
+			"PascalCase": pascalCase,
+		},
+	).Parse(
+		contractFileTemplate,
 	)
+	if err != nil {
+		return fmt.Errorf("contract '%s': parse contract file template: %w", contract.Key, err)
+	}
 
 	if err := tmpl.Execute(
 		contractFile,
 		contract,
 	); err != nil {
-		panic(err)
+		return fmt.Errorf("contract '%s': execute contract file template: %w", contract.Key, err)
 	}
 
+	return nil
 }
 
 const repositoryFileTemplate = `import {Repository} from '@/services/base/global.interfaces';
 import {EnumValueType, EnumHeaderAlign} from '@/services/base/global.enums';
 import {Section} from '@/services/base/global.classes.section';
 import {permissions} from '@/services/repositories/permissions';
-import {Attributes, Link} from '@/services/base/global.types';
 {{ Imports }}
 const entity = '{{ .NamePlural | CamelCase }}';
 const slug = '{{ .NamePlural | KebabCase }}';
 
 export interface {{ .NamePlural | PascalCase }} {
-{{range .Fields}}    {{ .Name | CamelCase }}: any;
+{{range .Fields}}    {{ .Name | CamelCase }}: {{ if IsAttribute . }}Attributes{{ else }}any{{ end }};
+{{end}}{{range Links}}    {{ .Name | CamelCase }}{{ if .IsOptional }}?{{ end }}: {{ if .IsMultiple }}Link[]{{ else }}Link{{ end }};
+{{end}}{{range AuditFields}}    {{ .Name | CamelCase }}?: any;
 {{end}}}
 
-const repository = new Repository<{{ .NamePlural | PascalCase }}>(slug, {}, {
+const repository = new Repository<{{ .NamePlural | PascalCase }}>(slug, permissions[entity], {
     freeTextSearch: {{ .EnableFreeTextSearch }},
     disableCreation: {{ .DisableCreate }},
 });
 {{range .Fields}}
 repository.addField('{{ .Name | CamelCase }}', {
-  type: EnumValueType.Text,
+{{ with PortalType . }}  type: {{ .ValueType }},{{ range .Options }}
+  {{ .Key }}: {{ .Value }},{{ end }}{{ end }}{{ if .EnableOptionsSupport }}
+  options: [{{ range .Options }}
+    {value: {{ .Value | TsLiteral }}, text: {{ .Text | TsString }}},{{ end }}
+  ],{{ end }}{{ with AttributeConstraint . }}
+  attributes: {
+    keys: [{{range .Keys}}
+      {
+        key: '{{ .Key }}',
+        type: {{ AttributeValueType .Type }},
+        optional: {{ .IsOptional }},
+      },{{end}}
+    ],
+    allowOtherKeys: {{ .AllowOtherKeys }},
+  },{{ end }}
+});
+{{end}}{{range Links}}
+repository.addField('{{ .Name | CamelCase }}', {
+  type: EnumValueType.Link,
+  link: {
+    entity: '{{ .Target.NamePlural | CamelCase }}',
+    slug: '{{ .Target.NamePlural | KebabCase }}',
+    multiple: {{ .IsMultiple }},
+  },
+});
+{{end}}{{range AuditFields}}
+repository.addField('{{ .Name | CamelCase }}', {
+  type: {{ (PortalType .).ValueType }},
+  hidden: true,
+  readonly: true,
 });
 {{end}}
 
 repository.setHeaders([
-{{range .Fields}}
-  {
-    fieldKey: '{{ .Name | CamelCase }}',
-    align: EnumHeaderAlign.Start,
+{{range Headers}}  {
+    fieldKey: '{{ .Key }}',
+    align: {{ .Align }},
+    sortable: {{ .Sortable }},{{ if .Width }}
+    width: '{{ .Width }}',{{ end }}
   },
-{{end}}
-]);
-
-{{ Sections }}
+{{end}}]);
+
+repository.setSections([
+{{range Sections}}  new Section('{{ .Key }}', {{ .Title | TsString }}, [{{range .Fields}}
+    '{{ . }}',{{end}}
+  ]),
+{{end}}]);
+
+repository.recordActions = [
+{{range RecordActions}}  {
+    color: '{{ .Color }}',
+    icon: '{{ .Icon }}',
+    title: {{ .Title | TsString }},
+    key: '{{ .Key }}',
+    action: {
+      method: '{{ .Method }}',
+      path: '{{ .Path }}',
+      download: {{ .Download }},
+    },
+  },
+{{end}}];
 
 repository.bulkActions = [
-  {
-    color: 'error',
-    icon: 'mdi-delete',
-    title: '$vuetify.entityList.delete',
-    key: 'delete'
-  }
-];
+{{range BulkActions}}  {
+    color: '{{ .Color }}',
+    icon: '{{ .Icon }}',
+    title: {{ .Title | TsString }},
+    key: '{{ .Key }}',{{ if .Path }}
+    action: {
+      method: '{{ .Method }}',
+      path: '{{ .Path }}',
+      download: {{ .Download }},
+    },{{ end }}
+  },
+{{end}}];
+
+// fluid:begin custom
+// fluid:end custom
 
 export const {{ .NamePlural | CamelCase }} = repository;
 `
 
-var buildRepositoryFile = func(entity fluid.Entity, directory string) {
+// repositoryTypeImports imports the global types a repository uses, or nothing when it uses none
+func repositoryTypeImports(entity fluid.Entity, links []resolvedLink) string {
+	var types []string
+	for _, field := range entity.Fields {
+		if isAttributeField(field) {
+			types = append(types, "Attributes")
+			break
+		}
+	}
+	if len(links) > 0 {
+		types = append(types, "Link")
+	}
+	if len(types) <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("import {%s} from '@/services/base/global.types';\n", strings.Join(types, ", "))
+}
+
+var buildRepositoryFile = func(project fluid.Project, extensions ProjectExtensions, entity fluid.Entity, directory string) error {
+
+	if err := checkAuditFieldNames("entity", entity.NameSingular, entityFieldNames(entity), entityAuditFieldNames(entity)); err != nil {
+		return err
+	}
 
 	repositoryFileName := fmt.Sprintf("%s.ts", kebabCase(entity.NameSingular))
 	repositoryFilePath := filepath.Join(directory, repositoryFileName)
 	repositoryFile, err := os.Create(repositoryFilePath)
 
 	if err != nil {
-		panic(err)
+		return ioError(fmt.Errorf("entity '%s': %w", entity.NameSingular, err))
 	}
 
 	defer func() { _ = repositoryFile.Close() }()
 
-	/* todo: add hidden fields
-	- createdAt
-	- modifiedAt
-	- deletedAt
-
-	- lockedAt (if has password field)
-	- loginAt (if has password field)
-	- loginAttempts (if has password field)
-	*/
-	// todo: handle link fields
-	// todo: handle attribute fields
-
-	tmpl := template.Must(
-		template.New(entity.NameSingular).Funcs(
-			template.FuncMap{
-				"Imports": func() string {
-					return "// todo: additional imports go here!\n"
-				},
-				"Sections": func() string {
-					return "// todo: sections go here!"
-				},
-				"FieldCase": func(value string) string {
-					if strings.ToLower(value) == "id" {
-						return "_id"
-					}
-					return camelCase(value)
-				},
-				"SnakeCase":  snakeCase,
-				"CamelCase":  camelCase,
-				"KebabCase":  kebabCase,
-				"TitleCase":  titleCase,
-				"PascalCase": pascalCase,
+	links, err := resolveLinks(project, extensions.entity(entity))
+	if err != nil {
+		return fmt.Errorf("entity '%s': %w", entity.NameSingular, err)
+	}
+
+	if err := checkPortalTypes(entity); err != nil {
+		return fmt.Errorf("entity '%s': %w", entity.NameSingular, err)
+	}
+
+	tmpl, err := template.New(entity.NameSingular).Funcs(
+		template.FuncMap{
+			"Imports": func() string {
+				return repositoryTypeImports(entity, links)
+			},
+			"Sections": func() []portalSection {
+				return entitySections(entity, links)
+			},
+			"Headers": func() []portalHeader {
+				return entityHeaders(entity, extensions.entity(entity), links)
+			},
+			"BulkActions": func() []portalAction {
+				return entityBulkActions(entity)
+			},
+			"RecordActions": func() []portalAction {
+				return entityRecordActions(entity)
 			},
-		).Parse(
-			repositoryFileTemplate,
-		),
+			"AuditFields": func() []fluid.EntityField {
+				return entityAuditFields(entity)
+			},
+			"Links": func() []resolvedLink {
+				return links
+			},
+			"IsAttribute": isAttributeField,
+			"AttributeConstraint": func(field fluid.EntityField) *AttributeConstraint {
+				if !isAttributeField(field) {
+					return nil
+				}
+				return extensions.entity(entity).attributeConstraint(field)
+			},
+			"AttributeValueType": func(valueType string) string {
+				return attributeValueTypes[valueType]
+			},
+			"PortalType": func(field fluid.EntityField) portalFieldType {
+				t, _ := entityFieldPortalType(field) // checked by checkPortalTypes
+				return t
+			},
+			"TsString":  tsString,
+			"TsLiteral": tsLiteral,
+			"FieldCase": func(value string) string {
+				if strings.ToLower(value) == "id" {
+					return "_id"
+				}
+				return camelCase(value)
+			},
+			"SnakeCase":  snakeCase,
+			"CamelCase":  camelCase,
+			"KebabCase":  kebabCase,
+			"TitleCase":  titleCase,
+			"PascalCase": pascalCase,
+		},
+	).Parse(
+		repositoryFileTemplate,
 	)
+	if err != nil {
+		return fmt.Errorf("entity '%s': parse repository file template: %w", entity.NameSingular, err)
+	}
 
 	if err := tmpl.Execute(
 		repositoryFile,
 		entity,
 	); err != nil {
-		panic(err)
+		return fmt.Errorf("entity '%s': execute repository file template: %w", entity.NameSingular, err)
 	}
 
+	return nil
 }
 
 func main() {
-	homeDirectory, err := os.UserHomeDir()
-
-	if err != nil {
-		panic(err)
+	if err := run(os.Args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return
+		}
+		if err != errUsage {
+			_, _ = fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		}
+		os.Exit(exitCode(err))
 	}
-
-	downloadDirectory := filepath.Join(homeDirectory, "Downloads")
-
-	updateCaches()
-	buildProject(fluidProjectScheme, downloadDirectory, false)
 }
 
 /* Routines */
 
 type BaseTemplateRepository struct {
+	Name              string
 	LatestReleaseInfo string
 	CacheDirectory    string
+	Source            TemplateSource
 }
 
-var extractTarball = func(gzipStream io.Reader, directory string) {
-	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
-		panic(err)
+// runCommand echoes an external command to stderr and runs it, the command's output is included in the returned error.
+// stdout is kept for the build results so dry runs and diffs can be piped
+var runCommand = func(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	_, _ = fmt.Fprintln(os.Stderr, cmd.String())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return fmt.Errorf("%s: %w: %s", cmd.String(), err, message)
+		}
+		return fmt.Errorf("%s: %w", cmd.String(), err)
 	}
+	return nil
+}
 
-	file, err := ioutil.TempFile("", "*.tag.gz")
-	if err != nil {
-		panic(err)
+var extractTarball = func(tarballPath string, directory string) error {
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return ioError(err)
 	}
-	defer func() { _ = os.Remove(file.Name()) }()
 
-	if _, err := io.Copy(file, gzipStream); err != nil {
-		panic(err)
+	if err := runCommand("tar", "-xf", tarballPath, "-C", directory, "--strip-components=1"); err != nil {
+		return cacheError(err)
 	}
 
-	cmd := exec.Command("tar", "-xf", file.Name(), "-C", directory, "--strip-components=1")
-	fmt.Println(cmd.String())
-	if err := cmd.Run(); err != nil {
-		panic(err)
-	}
+	return nil
 }
 
-var copyDirectory = func(sourceDirectory, targetDirectory string) {
+var copyDirectory = func(sourceDirectory, targetDirectory string) error {
 
-	cmd := exec.Command("cp", "-RL", sourceDirectory, targetDirectory)
-	fmt.Println(cmd.String())
-	if err := cmd.Run(); err != nil {
-		panic(err)
+	if err := runCommand("cp", "-RL", sourceDirectory, targetDirectory); err != nil {
+		return ioError(err)
 	}
 
+	return nil
 }
 
-var doRequest = func(client *http.Client, request *http.Request) ([]byte, int, error) {
-	var body []byte = nil
-	var code int = -1
-
-	response, err := client.Do(request)
+var getJson = func(uri string, model interface{}) error {
+	settings, err := loadHttpSettings()
 	if err != nil {
-		return nil, -1, err
+		return err
 	}
-	code = response.StatusCode
-
-	if response.Body != nil {
-		defer func() { _ = response.Body.Close() }()
 
-		data, readErr := ioutil.ReadAll(response.Body)
-		if readErr != nil {
-			return nil, -1, err
-		}
-
-		body = data
+	// revalidate the last response, an unchanged resource costs no rate limit
+	cached := readHttpCache(uri)
+	header := http.Header{"Accept": {"application/json"}}
+	if cached != nil {
+		header.Set("If-None-Match", cached.ETag)
 	}
 
-	return body, code, nil
-}
-
-var doStreamRequest = func(client *http.Client, request *http.Request) (io.ReadCloser, int, error) {
-	var code int = -1
-
-	response, err := client.Do(request)
+	response, err := sendRequest(settings, settings.client(settings.timeout), uri, header)
 	if err != nil {
-		return nil, -1, err
+		return err
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	var body []byte
+	switch {
+	case response.StatusCode == http.StatusNotModified && cached != nil:
+		body = cached.Body
+	case response.StatusCode == http.StatusOK:
+		if body, err = ioutil.ReadAll(response.Body); err != nil {
+			return cacheError(fmt.Errorf("GET %s: %w", uri, err))
+		}
+		if etag := response.Header.Get("ETag"); etag != "" && json.Valid(body) {
+			_ = writeHttpCache(httpCacheEntry{Url: uri, ETag: etag, Body: body})
+		}
+	default:
+		return cacheError(fmt.Errorf("GET %s: error code '%d' received", uri, response.StatusCode))
 	}
-	code = response.StatusCode
 
-	if response.Body != nil {
-		return response.Body, code, err
+	if err := json.Unmarshal(body, &model); err != nil {
+		return cacheError(fmt.Errorf("GET %s: %w", uri, err))
 	}
 
-	return nil, code, nil
+	return nil
 }
 
-var getJson = func(uri string, model interface{}) {
-	client := http.Client{
-		Timeout: time.Second * 2,
-	}
-
-	request, err := http.NewRequest(http.MethodGet, uri, nil)
+var getDownloadStream = func(uri string) (io.ReadCloser, error) {
+	settings, err := loadHttpSettings()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	body, code, err := doRequest(&client, request)
+	response, err := sendRequest(settings, settings.client(settings.downloadTimeout), uri, nil)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	if code != 200 {
-		panic(fmt.Sprintf("error code '%d' received", code))
+	if response.StatusCode != http.StatusOK {
+		_ = response.Body.Close()
+		return nil, cacheError(fmt.Errorf("GET %s: error code '%d' received", uri, response.StatusCode))
 	}
 
-	if err := json.Unmarshal(body, &model); err != nil {
-		panic(err)
-	}
+	return response.Body, nil
 }
 
-var getDownloadStream = func(uri string) io.ReadCloser {
-	client := http.Client{
-		Timeout: time.Minute * 2,
-	}
+var getCacheDirectory = func() (string, error) {
+	homeDirectory, err := os.UserHomeDir()
 
-	request, err := http.NewRequest(http.MethodGet, uri, nil)
 	if err != nil {
-		panic(err)
+		return "", ioError(err)
 	}
 
-	stream, code, err := doStreamRequest(&client, request)
-	if err != nil {
-		panic(err)
-	}
+	cacheDirectory := filepath.Join(homeDirectory, ".cache/fluid")
+	return cacheDirectory, nil
+}
 
-	if code != 200 {
-		panic(fmt.Sprintf("error code '%d' received", code))
+// resolveTemplateDirectory returns the directory a base template is copied from
+func resolveTemplateDirectory(templates map[string]string, name string) (string, error) {
+	if directory, ok := templates[name]; ok {
+		return directory, nil
 	}
 
-	if stream == nil {
-		panic("error not stream data received")
+	templateRepositories, err := getTemplateRepositories()
+	if err != nil {
+		return "", err
 	}
-
-	return stream
+	directory := ""
+	for _, templateRepository := range templateRepositories {
+		if templateRepository.Name != name {
+			continue
+		}
+		if templateRepository.Source.Type == TemplateSourceDirectory {
+			if _, err := os.Stat(templateRepository.Source.Path); err != nil {
+				return "", cacheError(fmt.Errorf("template '%s': source directory '%s' does not exist", name, templateRepository.Source.Path))
+			}
+			return templateRepository.Source.Path, nil
+		}
+		directory = filepath.Join(templateRepository.CacheDirectory, "latest")
+	}
+	if _, err := os.Stat(directory); err != nil {
+		return "", cacheError(fmt.Errorf("template '%s' is not cached at '%s', run 'fluid cache update' or build with -offline -embedded-templates to use the embedded template", name, directory))
+	}
+	return directory, nil
 }
 
-var getCacheDirectory = func() string {
-	homeDirectory, err := os.UserHomeDir()
+// templateNames lists the base templates in the order they are resolved
+var templateNames = []string{"api", "logic", "portal-ionic", "portal-vuetify"}
 
+var getTemplateRepositories = func() ([]BaseTemplateRepository, error) {
+	cacheDirectory, err := getCacheDirectory()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	cacheDirectory := filepath.Join(homeDirectory, ".cache/fluid")
-	return cacheDirectory
-}
-
-var updateCaches = func() {
-	cacheDirectory := getCacheDirectory()
-
-	if err := os.MkdirAll(cacheDirectory, os.ModePerm); err != nil {
-		panic(err)
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
 	}
 
 	templateRepositories := []BaseTemplateRepository{
 		{
+			Name:              "api",
 			LatestReleaseInfo: BaseApiLatestReleaseInfo,
 			CacheDirectory:    filepath.Join(cacheDirectory, "api"),
 		},
 		{
+			Name:              "logic",
 			LatestReleaseInfo: BaseLogicLatestReleaseInfo,
 			CacheDirectory:    filepath.Join(cacheDirectory, "logic"),
 		},
 		{
+			Name:              "portal-ionic",
 			LatestReleaseInfo: BasePortalIonicLatestReleaseInfo,
 			CacheDirectory:    filepath.Join(cacheDirectory, "portal-ionic"),
 		},
 		{
+			Name:              "portal-vuetify",
 			LatestReleaseInfo: BasePortalVuetifyLatestReleaseInfo,
 			CacheDirectory:    filepath.Join(cacheDirectory, "portal-vuetify"),
 		},
 	}
 
-	for _, templateRepository := range templateRepositories {
-
-		var releaseInfo struct {
-			TagName    string `json:"tag_name"`
-			TarballUrl string `json:"tarball_url"`
+	for i, templateRepository := range templateRepositories {
+		source := config.Templates[templateRepository.Name]
+		if source.Type == "" {
+			source.Type = TemplateSourceGithub
+		}
+		if source.Type == TemplateSourceGithub && (source.BaseUrl != "" || source.Repository != "") {
+			templateRepositories[i].LatestReleaseInfo = githubLatestReleaseInfo(source, templateRepository.LatestReleaseInfo)
 		}
+		templateRepositories[i].Source = source
+	}
 
-		ok := false
-		func() {
-			defer func() {
-				_ = recover()
-			}()
-			getJson(templateRepository.LatestReleaseInfo, &releaseInfo)
-			ok = true
-		}()
+	return templateRepositories, nil
+}
 
-		if !ok {
+// githubLatestReleaseInfo builds the latest release endpoint of a github source, the default repository is kept unless overridden
+func githubLatestReleaseInfo(source TemplateSource, defaultLatestReleaseInfo string) string {
+	baseUrl := strings.TrimRight(source.BaseUrl, "/")
+	if baseUrl == "" {
+		baseUrl = defaultGithubApiUrl
+	}
+	repository := strings.Trim(source.Repository, "/")
+	if repository == "" {
+		repository = strings.TrimSuffix(strings.TrimPrefix(defaultLatestReleaseInfo, defaultGithubApiUrl+"/repos/"), "/releases/latest")
+	}
+	return fmt.Sprintf("%s/repos/%s/releases/latest", baseUrl, repository)
+}
+
+var updateCaches = func() ([]TemplateLock, error) {
+	templateRepositories, err := getTemplateRepositories()
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []TemplateLock
+	for _, templateRepository := range templateRepositories {
+		if templateRepository.Source.Type == TemplateSourceDirectory {
 			continue
 		}
+		release, err := updateCache(templateRepository)
+		if err != nil {
+			return nil, fmt.Errorf("template '%s': %w", templateRepository.Name, err)
+		}
+		releases = append(releases, release)
+	}
 
-		releaseInfo.TagName = strings.TrimSpace(releaseInfo.TagName)
-		releaseInfo.TarballUrl = strings.TrimSpace(releaseInfo.TarballUrl)
+	return releases, nil
+}
+
+// updateCache caches the latest release of a base template and points the latest symlink at it
+var updateCache = func(templateRepository BaseTemplateRepository) (TemplateLock, error) {
+	tag, tarballUrl, err := resolveLatestRelease(templateRepository)
+	if err != nil {
+		return TemplateLock{}, err
+	}
 
-		if releaseInfo.TagName == "" {
-			panic("release info tag name may not be empty")
+	digest, err := cacheRelease(templateRepository, tag, tarballUrl, "")
+	if err != nil {
+		return TemplateLock{}, err
+	}
+
+	symLinkDirectory := filepath.Join(templateRepository.CacheDirectory, "latest")
+	_ = os.Remove(symLinkDirectory)
+	if err := os.Symlink(filepath.Join(templateRepository.CacheDirectory, tag), symLinkDirectory); err != nil {
+		return TemplateLock{}, ioError(err)
+	}
+
+	return TemplateLock{
+		Name:       templateRepository.Name,
+		Tag:        tag,
+		TarballUrl: tarballUrl,
+		Digest:     digest,
+	}, nil
+}
+
+// resolveLatestRelease returns the tag and tarball url of the latest release a template source offers
+var resolveLatestRelease = func(templateRepository BaseTemplateRepository) (string, string, error) {
+	source := templateRepository.Source
+	switch source.Type {
+	case TemplateSourceDirectory:
+		return "", "", cacheError(fmt.Errorf("'%s' is a local directory, it is used as is and never cached", source.Path))
+	case TemplateSourceTarball:
+		tag := strings.TrimSpace(source.Tag)
+		if tag == "" {
+			tag = tarballTag(source.Url)
+		}
+		return tag, source.Url, nil
+	case TemplateSourceGit:
+		ref := source.Ref
+		if ref == "" {
+			ref = "HEAD"
+		}
+		commit, err := gitCommit(source.Path, ref)
+		if err != nil {
+			return "", "", err
 		}
+		return commit[:12], gitTarballUrl(source.Path, commit), nil
+	}
+
+	var releaseInfo struct {
+		TagName    string `json:"tag_name"`
+		TarballUrl string `json:"tarball_url"`
+	}
+
+	if err := getJson(templateRepository.LatestReleaseInfo, &releaseInfo); err != nil {
+		return "", "", fmt.Errorf("fetch release info: %w", err)
+	}
+
+	releaseInfo.TagName = strings.TrimSpace(releaseInfo.TagName)
+	releaseInfo.TarballUrl = strings.TrimSpace(releaseInfo.TarballUrl)
+
+	if releaseInfo.TagName == "" {
+		return "", "", cacheError(errors.New("release info tag name may not be empty"))
+	}
+
+	if releaseInfo.TarballUrl == "" {
+		return "", "", cacheError(errors.New("release info tarball url may not be empty"))
+	}
+
+	return releaseInfo.TagName, releaseInfo.TarballUrl, nil
+}
 
-		if releaseInfo.TarballUrl == "" {
-			panic("release info tarball url may not be empty")
+// tarballTag derives a tag from the file name of a tarball url, base-api-v1.2.0.tar.gz is tagged base-api-v1.2.0
+func tarballTag(uri string) string {
+	if parsed, err := url.Parse(uri); err == nil {
+		uri = parsed.Path
+	}
+	tag := path.Base(uri)
+	for _, extension := range []string{".tar.gz", ".tgz", ".tar"} {
+		tag = strings.TrimSuffix(tag, extension)
+	}
+	if tag == "" || tag == "." || tag == "/" {
+		return "tarball"
+	}
+	return tag
+}
+
+// gitUrlPrefix marks tarball urls that are archived from a local git repository, the commit follows the #
+const gitUrlPrefix = "git+file://"
+
+func gitTarballUrl(repository, commit string) string {
+	return gitUrlPrefix + filepath.ToSlash(repository) + "#" + commit
+}
+
+func parseGitTarballUrl(uri string) (string, string, bool) {
+	if !strings.HasPrefix(uri, gitUrlPrefix) {
+		return "", "", false
+	}
+	index := strings.LastIndex(uri, "#")
+	if index < 0 {
+		return "", "", false
+	}
+	return filepath.FromSlash(uri[len(gitUrlPrefix):index]), uri[index+1:], true
+}
+
+// gitCommit resolves a ref of a local git repository to its full commit hash
+func gitCommit(repository, ref string) (string, error) {
+	output, err := exec.Command("git", "-C", repository, "rev-parse", "--verify", ref+"^{commit}").CombinedOutput()
+	if err != nil {
+		return "", cacheError(fmt.Errorf("resolve ref '%s' of '%s': %w: %s", ref, repository, err, strings.TrimSpace(string(output))))
+	}
+	commit := strings.TrimSpace(string(output))
+	if len(commit) < 12 {
+		return "", cacheError(fmt.Errorf("resolve ref '%s' of '%s': unexpected commit '%s'", ref, repository, commit))
+	}
+	return commit, nil
+}
+
+// digestPrefix names the hash algorithm of a release digest
+const digestPrefix = "sha256:"
+
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return digestPrefix + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// cacheRelease makes sure a release is cached as <tag>.tar.gz next to its extracted <tag> directory and returns the tarball digest,
+// a non-empty expectedDigest must match or the release is rejected
+var cacheRelease = func(templateRepository BaseTemplateRepository, tag, tarballUrl, expectedDigest string) (string, error) {
+	if err := os.MkdirAll(templateRepository.CacheDirectory, os.ModePerm); err != nil {
+		return "", ioError(err)
+	}
+
+	releaseCacheDirectory := filepath.Join(templateRepository.CacheDirectory, tag)
+	tarballPath := releaseCacheDirectory + ".tar.gz"
+
+	if _, err := os.Stat(tarballPath); os.IsNotExist(err) {
+		if err := downloadTarball(tarballUrl, tarballPath); err != nil {
+			return "", fmt.Errorf("download release '%s': %w", tag, err)
+		}
+	}
+
+	digest, err := fileDigest(tarballPath)
+	if err != nil {
+		return "", ioError(err)
+	}
+	if expectedDigest != "" && digest != expectedDigest {
+		return "", cacheError(fmt.Errorf("release '%s': digest '%s' does not match the locked digest '%s'", tag, digest, expectedDigest))
+	}
+
+	if _, err := os.Stat(releaseCacheDirectory); os.IsNotExist(err) {
+		if err := extractTarball(tarballPath, releaseCacheDirectory); err != nil {
+			// never leave a partially extracted release behind, it would be mistaken for a complete one next time
+			_ = os.RemoveAll(releaseCacheDirectory)
+			return "", fmt.Errorf("extract release '%s': %w", tag, err)
 		}
+		if err := writeReleaseRecord(templateRepository, TemplateLock{Name: templateRepository.Name, Tag: tag, TarballUrl: tarballUrl, Digest: digest}); err != nil {
+			return "", fmt.Errorf("record release '%s': %w", tag, err)
+		}
+	}
 
-		latestReleaseCacheDirectory := filepath.Join(templateRepository.CacheDirectory, releaseInfo.TagName)
+	return digest, nil
+}
+
+// downloadTarball writes a tarball to a temporary file first so an interrupted download never ends up in the cache,
+// besides http urls it archives git+file urls from a local repository and copies file urls
+func downloadTarball(uri, path string) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), "*.download")
+	if err != nil {
+		return ioError(err)
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
 
-		if _, err := os.Stat(latestReleaseCacheDirectory); os.IsNotExist(err) {
-			func() {
-				stream := getDownloadStream(releaseInfo.TarballUrl)
-				defer func() { _ = stream.Close() }()
-				extractTarball(stream, latestReleaseCacheDirectory)
-			}()
+	if repository, commit, ok := parseGitTarballUrl(uri); ok {
+		_ = file.Close()
+		if err := runCommand("git", "-C", repository, "archive", "--format=tar.gz", "--prefix=template/", "-o", file.Name(), commit); err != nil {
+			return cacheError(err)
+		}
+	} else {
+		var stream io.ReadCloser
+		if strings.HasPrefix(uri, "file://") {
+			if stream, err = os.Open(filepath.FromSlash(strings.TrimPrefix(uri, "file://"))); err != nil {
+				_ = file.Close()
+				return cacheError(err)
+			}
+		} else if stream, err = getDownloadStream(uri); err != nil {
+			_ = file.Close()
+			return err
 		}
+		defer func() { _ = stream.Close() }()
 
-		symLinkDirectory := filepath.Join(templateRepository.CacheDirectory, "latest")
-		_ = os.Remove(symLinkDirectory)
-		if err := os.Symlink(latestReleaseCacheDirectory, symLinkDirectory); err != nil {
-			panic(err)
+		if _, err := io.Copy(file, stream); err != nil {
+			_ = file.Close()
+			return cacheError(fmt.Errorf("download tarball: %w", err))
 		}
+		if err := file.Close(); err != nil {
+			return ioError(err)
+		}
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return ioError(err)
 	}
+	return nil
 }
 
 /* Helpers */
@@ -686,9 +1160,7 @@ func keep(text string, keepset string) string {
 	for i < l {
 		r := rune(text[i])
 		if strings.ContainsRune(keepset, r) {
-			if _, err := keep.WriteRune(r); err != nil {
-				panic(err)
-			}
+			keep.WriteRune(r)
 		}
 		i++
 	}
@@ -0,0 +1,604 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// generatedBaseDirectory keeps a pristine copy of the last generation inside the output, it is the base of the three-way merge
+const generatedBaseDirectory = ".fluid/generated"
+
+const (
+	OutputCreate   = "create"   // the file is new
+	OutputUpdate   = "update"   // the file had no local changes and is replaced by the new generation
+	OutputMerge    = "merge"    // local changes and generator changes were merged without overlap
+	OutputConflict = "conflict" // local changes and generator changes overlap
+	OutputDelete   = "delete"   // the file is no longer generated and had no local changes
+	OutputKeep     = "keep"     // the file is left as it is
+)
+
+// outputChange is what happens to a single file of the output directory, Content is nil when nothing is written
+type outputChange struct {
+	Path     string
+	Action   string
+	Reason   string
+	Content  []byte
+	Current  []byte // content currently in the output directory, nil when the file does not exist
+	Mode     os.FileMode
+	Conflict bool
+}
+
+var (
+	regionBeginPattern = regexp.MustCompile(`fluid:begin\s+([A-Za-z0-9_.-]+)`)
+	regionEndPattern   = regexp.MustCompile(`fluid:end\s+([A-Za-z0-9_.-]+)`)
+)
+
+// listFiles returns the regular files below a directory relative to it, the generated base is skipped
+func listFiles(directory string) (map[string]os.FileInfo, error) {
+	files := map[string]os.FileInfo{}
+	if _, err := os.Stat(directory); os.IsNotExist(err) {
+		return files, nil
+	}
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if relativePath == filepath.Dir(generatedBaseDirectory) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			files[filepath.ToSlash(relativePath)] = info
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, ioError(err)
+	}
+	return files, nil
+}
+
+func readOptionalFile(path string) ([]byte, bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, ioError(err)
+	}
+	return data, true, nil
+}
+
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+func splitLines(data []byte) []string {
+	if len(data) <= 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// extractRegions returns the content of every complete protected region, keyed by region name
+func extractRegions(lines []string) map[string][]string {
+	regions := map[string][]string{}
+	for i := 0; i < len(lines); i++ {
+		begin := regionBeginPattern.FindStringSubmatch(lines[i])
+		if begin == nil {
+			continue
+		}
+		for j := i + 1; j < len(lines); j++ {
+			if end := regionEndPattern.FindStringSubmatch(lines[j]); end != nil {
+				if end[1] == begin[1] {
+					regions[begin[1]] = lines[i+1 : j]
+					i = j
+				}
+				break
+			}
+		}
+	}
+	return regions
+}
+
+// applyRegions carries the content of protected regions over into newly generated lines, regions the new lines lack are returned as orphans
+func applyRegions(lines []string, regions map[string][]string) ([]string, []string) {
+	if len(regions) <= 0 {
+		return lines, nil
+	}
+
+	used := map[string]bool{}
+	var result []string
+	for i := 0; i < len(lines); i++ {
+		result = append(result, lines[i])
+		begin := regionBeginPattern.FindStringSubmatch(lines[i])
+		if begin == nil {
+			continue
+		}
+		content, ok := regions[begin[1]]
+		if !ok {
+			continue
+		}
+		end := -1
+		for j := i + 1; j < len(lines); j++ {
+			if match := regionEndPattern.FindStringSubmatch(lines[j]); match != nil && match[1] == begin[1] {
+				end = j
+				break
+			}
+		}
+		if end < 0 {
+			continue
+		}
+		used[begin[1]] = true
+		result = append(result, content...)
+		i = end - 1
+	}
+
+	var orphans []string
+	for name, content := range regions {
+		if !used[name] && strings.TrimSpace(strings.Join(content, "")) != "" {
+			orphans = append(orphans, name)
+		}
+	}
+	sort.Strings(orphans)
+	return result, orphans
+}
+
+// diffMatches returns the index pairs of the lines a and b have in common using the myers diff algorithm
+func diffMatches(a, b []string) [][2]int {
+	var matches [][2]int
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		matches = append(matches, [2]int{prefix, prefix})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	x0, y0 := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(x0), len(y0)
+	if n > 0 && m > 0 {
+		offset := n + m + 1
+		v := make([]int, 2*offset+1)
+		var trace [][]int
+	search:
+		for d := 0; d <= n+m; d++ {
+			trace = append(trace, append([]int(nil), v...))
+			for k := -d; k <= d; k += 2 {
+				var x int
+				if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+					x = v[offset+k+1]
+				} else {
+					x = v[offset+k-1] + 1
+				}
+				y := x - k
+				for x < n && y < m && x0[x] == y0[y] {
+					x++
+					y++
+				}
+				v[offset+k] = x
+				if x >= n && y >= m {
+					break search
+				}
+			}
+		}
+
+		var middle [][2]int
+		x, y := n, m
+		for d := len(trace) - 1; d >= 0; d-- {
+			v := trace[d]
+			k := x - y
+			var previousK int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				previousK = k + 1
+			} else {
+				previousK = k - 1
+			}
+			previousX := v[offset+previousK]
+			previousY := previousX - previousK
+			for x > previousX && y > previousY {
+				x--
+				y--
+				middle = append(middle, [2]int{prefix + x, prefix + y})
+			}
+			if d > 0 {
+				x, y = previousX, previousY
+			}
+		}
+		for i := len(middle) - 1; i >= 0; i-- {
+			matches = append(matches, middle[i])
+		}
+	}
+
+	for i := suffix; i > 0; i-- {
+		matches = append(matches, [2]int{len(a) - i, len(b) - i})
+	}
+	return matches
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// merge2 merges two versions without a common base, every difference between them is written between conflict markers
+func merge2(ours, theirs []string) ([]string, bool) {
+	var result []string
+	conflict := false
+	a, b := 0, 0
+	flush := func(oursEnd, theirsEnd int) {
+		if a >= oursEnd && b >= theirsEnd {
+			return
+		}
+		conflict = true
+		result = append(result, "<<<<<<< current\n")
+		result = append(result, terminateLines(ours[a:oursEnd])...)
+		result = append(result, "=======\n")
+		result = append(result, terminateLines(theirs[b:theirsEnd])...)
+		result = append(result, ">>>>>>> generated\n")
+	}
+
+	for _, match := range diffMatches(ours, theirs) {
+		flush(match[0], match[1])
+		result = append(result, ours[match[0]])
+		a, b = match[0]+1, match[1]+1
+	}
+	flush(len(ours), len(theirs))
+
+	return result, conflict
+}
+
+// merge3 merges the changes from base to ours and from base to theirs, overlapping changes are written between conflict markers
+func merge3(base, ours, theirs []string) ([]string, bool) {
+	oursMatches := map[int]int{}
+	for _, match := range diffMatches(base, ours) {
+		oursMatches[match[0]] = match[1]
+	}
+	theirsMatches := map[int]int{}
+	for _, match := range diffMatches(base, theirs) {
+		theirsMatches[match[0]] = match[1]
+	}
+
+	var result []string
+	conflict := false
+	i, a, b := 0, 0, 0
+	for {
+		// copy lines that are unchanged on both sides
+		for i < len(base) && oursMatches[i] == a && theirsMatches[i] == b && hasMatch(oursMatches, i) && hasMatch(theirsMatches, i) {
+			result = append(result, base[i])
+			i, a, b = i+1, a+1, b+1
+		}
+
+		// find the next base line both sides kept, everything before it is a changed chunk
+		next := i
+		for ; next < len(base); next++ {
+			o, okOurs := oursMatches[next]
+			t, okTheirs := theirsMatches[next]
+			if okOurs && okTheirs && o >= a && t >= b {
+				break
+			}
+		}
+
+		oursEnd, theirsEnd := len(ours), len(theirs)
+		if next < len(base) {
+			oursEnd, theirsEnd = oursMatches[next], theirsMatches[next]
+		}
+
+		baseChunk, oursChunk, theirsChunk := base[i:next], ours[a:oursEnd], theirs[b:theirsEnd]
+		switch {
+		case equalLines(oursChunk, baseChunk):
+			result = append(result, theirsChunk...)
+		case equalLines(theirsChunk, baseChunk), equalLines(oursChunk, theirsChunk):
+			result = append(result, oursChunk...)
+		default:
+			conflict = true
+			result = append(result, "<<<<<<< current\n")
+			result = append(result, terminateLines(oursChunk)...)
+			result = append(result, "=======\n")
+			result = append(result, terminateLines(theirsChunk)...)
+			result = append(result, ">>>>>>> generated\n")
+		}
+
+		if next >= len(base) {
+			break
+		}
+		i, a, b = next, oursEnd, theirsEnd
+	}
+
+	return result, conflict
+}
+
+func hasConflictMarkers(lines []string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, "<<<<<<< current") || strings.HasPrefix(line, ">>>>>>> generated") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMatch(matches map[int]int, index int) bool {
+	_, ok := matches[index]
+	return ok
+}
+
+// terminateLines makes sure the last line of a conflict chunk ends with a newline so the markers stay on their own lines
+func terminateLines(lines []string) []string {
+	if len(lines) <= 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+	result := append([]string{}, lines...)
+	result[len(result)-1] += "\n"
+	return result
+}
+
+// planFile decides what happens to a generated file given the previous generation (base) and the file currently in the output (current)
+func planFile(path string, generated, base, current []byte, hasBase, baseExists, currentExists bool) outputChange {
+	change := outputChange{Path: path, Current: current}
+
+	if !currentExists {
+		change.Action, change.Content = OutputCreate, generated
+		return change
+	}
+
+	if bytes.Equal(current, generated) {
+		change.Action = OutputKeep
+		return change
+	}
+
+	if isStubContent(generated) {
+		change.Action, change.Reason = OutputKeep, "stub"
+		return change
+	}
+
+	if isBinary(generated) || isBinary(current) || (baseExists && isBinary(base)) {
+		switch {
+		case baseExists && bytes.Equal(current, base):
+			change.Action, change.Content = OutputUpdate, generated
+		case baseExists && bytes.Equal(generated, base):
+			change.Action, change.Reason = OutputKeep, "local changes"
+		case !baseExists:
+			change.Action, change.Conflict = OutputConflict, true
+			change.Reason = "binary file differs from the generated one and there is no previous generation to merge with, the local file was kept"
+		default:
+			change.Action, change.Conflict = OutputConflict, true
+			change.Reason = "binary file changed locally and by the generator, the local file was kept"
+		}
+		return change
+	}
+
+	currentLines := splitLines(current)
+	regions := extractRegions(currentLines)
+	generatedLines, orphans := applyRegions(splitLines(generated), regions)
+	if len(orphans) > 0 {
+		change.Action, change.Conflict = OutputConflict, true
+		change.Reason = fmt.Sprintf("protected region(s) %s are no longer generated, the local file was kept", strings.Join(orphans, ", "))
+		return change
+	}
+	merged := []byte(strings.Join(generatedLines, ""))
+
+	if bytes.Equal(current, merged) {
+		change.Action = OutputKeep
+		return change
+	}
+
+	if !baseExists {
+		// without a previous generation local edits cannot be told apart from generator changes, every difference is marked
+		change.Action, change.Conflict = OutputConflict, true
+		change.Reason = "file was added locally and is now generated"
+		if !hasBase {
+			change.Reason = "file differs from the generated one and there is no previous generation to merge with"
+		}
+		lines, _ := merge2(currentLines, generatedLines)
+		change.Content = []byte(strings.Join(lines, ""))
+		return change
+	}
+
+	baseLines, _ := applyRegions(splitLines(base), regions)
+	if equalLines(currentLines, baseLines) {
+		change.Action, change.Content = OutputUpdate, merged
+		return change
+	}
+	if equalLines(generatedLines, baseLines) {
+		change.Action, change.Reason = OutputKeep, "local changes"
+		if hasConflictMarkers(currentLines) {
+			change.Conflict, change.Reason = true, "unresolved conflict markers"
+		}
+		return change
+	}
+
+	lines, conflict := merge3(baseLines, currentLines, generatedLines)
+	change.Action, change.Content = OutputMerge, []byte(strings.Join(lines, ""))
+	if conflict {
+		change.Action, change.Conflict = OutputConflict, true
+		change.Reason = "local changes overlap with generator changes"
+	}
+	return change
+}
+
+// planOutput works out how a freshly generated project is written into an output directory without losing local changes
+var planOutput = func(projectDirectory, outputDirectory string) ([]outputChange, error) {
+	baseDirectory := filepath.Join(outputDirectory, generatedBaseDirectory)
+	_, err := os.Stat(baseDirectory)
+	hasBase := err == nil
+
+	generatedFiles, err := listFiles(projectDirectory)
+	if err != nil {
+		return nil, err
+	}
+	baseFiles, err := listFiles(baseDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []outputChange
+	for path, info := range generatedFiles {
+		generated, err := ioutil.ReadFile(filepath.Join(projectDirectory, path))
+		if err != nil {
+			return nil, ioError(err)
+		}
+		base, baseExists, err := readOptionalFile(filepath.Join(baseDirectory, path))
+		if err != nil {
+			return nil, err
+		}
+		current, currentExists, err := readOptionalFile(filepath.Join(outputDirectory, path))
+		if err != nil {
+			return nil, err
+		}
+
+		change := planFile(path, generated, base, current, hasBase, baseExists, currentExists)
+		change.Mode = info.Mode()
+		changes = append(changes, change)
+	}
+
+	for path := range baseFiles {
+		if _, ok := generatedFiles[path]; ok {
+			continue
+		}
+		base, err := ioutil.ReadFile(filepath.Join(baseDirectory, path))
+		if err != nil {
+			return nil, ioError(err)
+		}
+		current, currentExists, err := readOptionalFile(filepath.Join(outputDirectory, path))
+		if err != nil {
+			return nil, err
+		}
+		if !currentExists {
+			continue
+		}
+		change := outputChange{Path: path, Action: OutputDelete, Current: current}
+		if !bytes.Equal(base, current) {
+			change.Action, change.Reason = OutputKeep, "no longer generated but changed locally"
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// applyOutput writes the planned changes and records the new generation as the base of the next merge, files kept in
+// conflict keep their previous base so the conflict is reported again until it is resolved
+var applyOutput = func(changes []outputChange, projectDirectory, outputDirectory string) error {
+	baseDirectory := filepath.Join(outputDirectory, generatedBaseDirectory)
+
+	type previousBase struct {
+		content []byte
+		exists  bool
+	}
+	previousBases := map[string]previousBase{}
+	for _, change := range changes {
+		if !change.Conflict || change.Content != nil {
+			continue
+		}
+		content, exists, err := readOptionalFile(filepath.Join(baseDirectory, filepath.FromSlash(change.Path)))
+		if err != nil {
+			return err
+		}
+		previousBases[change.Path] = previousBase{content: content, exists: exists}
+	}
+
+	for _, change := range changes {
+		path := filepath.Join(outputDirectory, filepath.FromSlash(change.Path))
+		switch {
+		case change.Action == OutputDelete:
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return ioError(err)
+			}
+			removeEmptyDirectories(filepath.Dir(path), outputDirectory)
+		case change.Content != nil:
+			if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+				return ioError(err)
+			}
+			if err := ioutil.WriteFile(path, change.Content, change.Mode.Perm()); err != nil {
+				return ioError(err)
+			}
+		}
+	}
+
+	if err := os.RemoveAll(baseDirectory); err != nil {
+		return ioError(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(baseDirectory), os.ModePerm); err != nil {
+		return ioError(err)
+	}
+	if err := copyDirectory(projectDirectory, baseDirectory); err != nil {
+		return err
+	}
+
+	for path, previous := range previousBases {
+		basePath := filepath.Join(baseDirectory, filepath.FromSlash(path))
+		if !previous.exists {
+			if err := os.Remove(basePath); err != nil && !os.IsNotExist(err) {
+				return ioError(err)
+			}
+			continue
+		}
+		if err := ioutil.WriteFile(basePath, previous.content, 0644); err != nil {
+			return ioError(err)
+		}
+	}
+	return nil
+}
+
+func removeEmptyDirectories(directory, root string) {
+	for directory != root && strings.HasPrefix(directory, root) {
+		if err := os.Remove(directory); err != nil {
+			return
+		}
+		directory = filepath.Dir(directory)
+	}
+}
+
+// printOutputChanges lists the files that were merged, deleted or kept for a reason followed by a summary, it returns the number of conflicts
+func printOutputChanges(w io.Writer, changes []outputChange) int {
+	counts := map[string]int{}
+	conflicts := 0
+	for _, change := range changes {
+		counts[change.Action]++
+		if change.Conflict {
+			conflicts++
+		}
+		switch {
+		case change.Action == OutputCreate, change.Action == OutputUpdate, change.Action == OutputKeep && change.Reason == "":
+			continue
+		}
+		if change.Reason != "" {
+			_, _ = fmt.Fprintf(w, "%-8s %s (%s)\n", change.Action, change.Path, change.Reason)
+		} else {
+			_, _ = fmt.Fprintf(w, "%-8s %s\n", change.Action, change.Path)
+		}
+	}
+	_, _ = fmt.Fprintf(w, "%d created, %d updated, %d merged, %d deleted, %d kept, %d conflict(s)\n",
+		counts[OutputCreate], counts[OutputUpdate], counts[OutputMerge], counts[OutputDelete], counts[OutputKeep], conflicts)
+	return conflicts
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func lines(values ...string) []string {
+	var result []string
+	for _, value := range values {
+		result = append(result, value+"\n")
+	}
+	return result
+}
+
+func TestMerge3(t *testing.T) {
+	base := lines("a", "b", "c", "d", "e")
+
+	tests := []struct {
+		name     string
+		ours     []string
+		theirs   []string
+		expected []string
+		conflict bool
+	}{
+		{
+			name:     "unchanged",
+			ours:     base,
+			theirs:   base,
+			expected: base,
+		},
+		{
+			name:     "only generator changes",
+			ours:     base,
+			theirs:   lines("a", "B", "c", "d", "e"),
+			expected: lines("a", "B", "c", "d", "e"),
+		},
+		{
+			name:     "only local changes",
+			ours:     lines("a", "b", "c", "d", "e", "f"),
+			theirs:   base,
+			expected: lines("a", "b", "c", "d", "e", "f"),
+		},
+		{
+			name:     "separate changes",
+			ours:     lines("A", "b", "c", "d", "e"),
+			theirs:   lines("a", "b", "c", "d", "E"),
+			expected: lines("A", "b", "c", "d", "E"),
+		},
+		{
+			name:     "identical changes",
+			ours:     lines("a", "b", "C", "d", "e"),
+			theirs:   lines("a", "b", "C", "d", "e"),
+			expected: lines("a", "b", "C", "d", "e"),
+		},
+		{
+			name:     "overlapping changes",
+			ours:     lines("a", "b", "mine", "d", "e"),
+			theirs:   lines("a", "b", "theirs", "d", "e"),
+			expected: lines("a", "b", "<<<<<<< current", "mine", "=======", "theirs", ">>>>>>> generated", "d", "e"),
+			conflict: true,
+		},
+		{
+			name:     "local deletion next to generator change",
+			ours:     lines("a", "c", "d", "e"),
+			theirs:   lines("a", "b", "c", "d", "e", "f"),
+			expected: lines("a", "c", "d", "e", "f"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged, conflict := merge3(base, test.ours, test.theirs)
+			if conflict != test.conflict || !equalLines(merged, test.expected) {
+				t.Errorf("expected %q (conflict %t), got %q (conflict %t)", test.expected, test.conflict, merged, conflict)
+			}
+		})
+	}
+}
+
+func TestMerge2MarksOnlyDifferences(t *testing.T) {
+	merged, conflict := merge2(lines("a", "mine", "c"), lines("a", "theirs", "c"))
+	expected := lines("a", "<<<<<<< current", "mine", "=======", "theirs", ">>>>>>> generated", "c")
+	if !conflict || !equalLines(merged, expected) {
+		t.Errorf("expected %q, got %q", expected, merged)
+	}
+
+	if merged, conflict := merge2(lines("a", "b"), lines("a", "b")); conflict || !equalLines(merged, lines("a", "b")) {
+		t.Errorf("expected equal versions to merge cleanly, got %q", merged)
+	}
+}
+
+func TestRegionsAreCarriedOver(t *testing.T) {
+	current := lines("old header", "// fluid:begin custom", "mine", "// fluid:end custom")
+	generated := lines("new header", "// fluid:begin custom", "// fluid:end custom", "footer")
+
+	result, orphans := applyRegions(generated, extractRegions(current))
+	expected := lines("new header", "// fluid:begin custom", "mine", "// fluid:end custom", "footer")
+	if len(orphans) > 0 || !equalLines(result, expected) {
+		t.Errorf("expected %q, got %q with orphans %v", expected, result, orphans)
+	}
+
+	_, orphans = applyRegions(lines("no regions"), extractRegions(current))
+	if len(orphans) != 1 || orphans[0] != "custom" {
+		t.Errorf("expected the custom region to be orphaned, got %v", orphans)
+	}
+}
+
+func TestPlanFile(t *testing.T) {
+	text := func(values ...string) []byte { return []byte(strings.Join(lines(values...), "")) }
+
+	tests := []struct {
+		name          string
+		generated     []byte
+		base          []byte
+		current       []byte
+		hasBase       bool
+		baseExists    bool
+		currentExists bool
+		action        string
+		conflict      bool
+		content       []byte
+	}{
+		{
+			name:      "new file",
+			generated: text("a"),
+			action:    OutputCreate,
+			content:   text("a"),
+		},
+		{
+			name:          "unchanged file",
+			generated:     text("a"),
+			base:          text("a"),
+			current:       text("a"),
+			hasBase:       true,
+			baseExists:    true,
+			currentExists: true,
+			action:        OutputKeep,
+		},
+		{
+			name:          "no local changes",
+			generated:     text("b"),
+			base:          text("a"),
+			current:       text("a"),
+			hasBase:       true,
+			baseExists:    true,
+			currentExists: true,
+			action:        OutputUpdate,
+			content:       text("b"),
+		},
+		{
+			name:          "only local changes",
+			generated:     text("a"),
+			base:          text("a"),
+			current:       text("mine"),
+			hasBase:       true,
+			baseExists:    true,
+			currentExists: true,
+			action:        OutputKeep,
+		},
+		{
+			name:          "first build into a changed file",
+			generated:     text("a", "b"),
+			current:       text("a", "mine"),
+			currentExists: true,
+			action:        OutputConflict,
+			conflict:      true,
+			content:       text("a", "<<<<<<< current", "mine", "=======", "b", ">>>>>>> generated"),
+		},
+		{
+			name:          "binary file changed on both sides",
+			generated:     []byte("generated\x00"),
+			base:          []byte("base\x00"),
+			current:       []byte("mine\x00"),
+			hasBase:       true,
+			baseExists:    true,
+			currentExists: true,
+			action:        OutputConflict,
+			conflict:      true,
+		},
+		{
+			name:          "first build into a changed binary file",
+			generated:     []byte("generated\x00"),
+			current:       []byte("mine\x00"),
+			currentExists: true,
+			action:        OutputConflict,
+			conflict:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			change := planFile("file", test.generated, test.base, test.current, test.hasBase, test.baseExists, test.currentExists)
+			if change.Action != test.action || change.Conflict != test.conflict || !bytes.Equal(change.Content, test.content) {
+				t.Errorf("expected %s (conflict %t) writing %q, got %s (conflict %t, %s) writing %q",
+					test.action, test.conflict, test.content, change.Action, change.Conflict, change.Reason, change.Content)
+			}
+		})
+	}
+}
+
+func TestApplyOutputKeepsTheBaseOfConflicts(t *testing.T) {
+	projectDirectory, outputDirectory := t.TempDir(), t.TempDir()
+	baseDirectory := filepath.Join(outputDirectory, generatedBaseDirectory)
+
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(projectDirectory, "image.bin"), "generated\x00")
+	write(filepath.Join(projectDirectory, "new.bin"), "generated\x00")
+	write(filepath.Join(projectDirectory, "text.txt"), "new\n")
+	write(filepath.Join(baseDirectory, "image.bin"), "base\x00")
+	write(filepath.Join(baseDirectory, "text.txt"), "old\n")
+	write(filepath.Join(outputDirectory, "image.bin"), "mine\x00")
+	write(filepath.Join(outputDirectory, "new.bin"), "mine\x00")
+	write(filepath.Join(outputDirectory, "text.txt"), "old\n")
+
+	changes, err := planOutput(projectDirectory, outputDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyOutput(changes, projectDirectory, outputDirectory); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(path string) string {
+		data, _ := ioutil.ReadFile(path)
+		return string(data)
+	}
+	if got := read(filepath.Join(outputDirectory, "image.bin")); got != "mine\x00" {
+		t.Errorf("expected the local binary file to be kept, got %q", got)
+	}
+	if got := read(filepath.Join(baseDirectory, "image.bin")); got != "base\x00" {
+		t.Errorf("expected the base of the conflicted file to be kept, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(baseDirectory, "new.bin")); !os.IsNotExist(err) {
+		t.Errorf("expected a conflicted file without a base to stay without one")
+	}
+	if got := read(filepath.Join(baseDirectory, "text.txt")); got != "new\n" {
+		t.Errorf("expected the base of the updated file to advance, got %q", got)
+	}
+
+	// the conflicts are reported again on the next build
+	changes, err = planOutput(projectDirectory, outputDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conflicts := 0
+	for _, change := range changes {
+		if change.Conflict {
+			conflicts++
+		}
+	}
+	if conflicts != 2 {
+		t.Errorf("expected both binary conflicts to be reported again, got %d", conflicts)
+	}
+}
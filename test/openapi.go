@@ -0,0 +1,606 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-fluid/fluid"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const openApiVersion = "3.0.3"
+
+// OpenApi is the subset of an OpenAPI 3 document that the generator produces
+type OpenApi struct {
+	OpenApi    string                     `json:"openapi"`
+	Info       OpenApiInfo                `json:"info"`
+	Tags       []OpenApiTag               `json:"tags,omitempty"`
+	Paths      map[string]OpenApiPathItem `json:"paths"`
+	Components OpenApiComponents          `json:"components"`
+}
+
+type OpenApiInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type OpenApiTag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenApiPathItem maps lower case http methods to operations
+type OpenApiPathItem map[string]*OpenApiOperation
+
+type OpenApiOperation struct {
+	OperationId string                     `json:"operationId"`
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []OpenApiParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenApiRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenApiResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security"`
+}
+
+type OpenApiParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *OpenApiSchema `json:"schema"`
+}
+
+type OpenApiRequestBody struct {
+	Description string                      `json:"description,omitempty"`
+	Required    bool                        `json:"required,omitempty"`
+	Content     map[string]OpenApiMediaType `json:"content"`
+}
+
+type OpenApiResponse struct {
+	Description string                      `json:"description"`
+	Headers     map[string]OpenApiHeader    `json:"headers,omitempty"`
+	Content     map[string]OpenApiMediaType `json:"content,omitempty"`
+}
+
+type OpenApiHeader struct {
+	Description string         `json:"description,omitempty"`
+	Schema      *OpenApiSchema `json:"schema"`
+}
+
+type OpenApiMediaType struct {
+	Schema  *OpenApiSchema `json:"schema"`
+	Example interface{}    `json:"example,omitempty"`
+}
+
+type OpenApiSchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Title                string                    `json:"title,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Default              interface{}               `json:"default,omitempty"`
+	Enum                 []interface{}             `json:"enum,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	ReadOnly             bool                      `json:"readOnly,omitempty"`
+	WriteOnly            bool                      `json:"writeOnly,omitempty"`
+	Items                *OpenApiSchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenApiSchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties interface{}               `json:"additionalProperties,omitempty"`
+	Minimum              *int                      `json:"minimum,omitempty"`
+
+	order []string // property names in schema order, json output is sorted but the docs follow the schema
+}
+
+func (s *OpenApiSchema) setProperty(name string, property *OpenApiSchema) {
+	if s.Properties == nil {
+		s.Properties = map[string]*OpenApiSchema{}
+	}
+	if _, ok := s.Properties[name]; !ok {
+		s.order = append(s.order, name)
+	}
+	s.Properties[name] = property
+}
+
+type OpenApiComponents struct {
+	Schemas         map[string]*OpenApiSchema        `json:"schemas"`
+	SecuritySchemes map[string]OpenApiSecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type OpenApiSecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+const openApiBearerAuth = "bearerAuth"
+
+// entityFieldOpenApiTypes maps every entity field type to an openapi type and format
+var entityFieldOpenApiTypes = map[string]OpenApiSchema{
+	fluid.EntityFieldTypePassword:  {Type: "string", Format: "password", WriteOnly: true},
+	fluid.EntityFieldTypeBinary:    {Type: "string", Format: "byte"},
+	fluid.EntityFieldTypeString:    {Type: "string"},
+	fluid.EntityFieldTypeUuid:      {Type: "string", Format: "uuid"},
+	fluid.EntityFieldTypeDate:      {Type: "string", Format: "date"},
+	fluid.EntityFieldTypeDateTime:  {Type: "string", Format: "date-time"},
+	fluid.EntityFieldTypeTime:      {Type: "string", Format: "time"},
+	fluid.EntityFieldTypeInteger:   {Type: "integer", Format: "int64"},
+	fluid.EntityFieldTypeDecimal:   {Type: "number", Format: "double"},
+	fluid.EntityFieldTypeBoolean:   {Type: "boolean"},
+	fluid.EntityFieldTypeMoney:     {Type: "integer", Format: "int64", Description: "Money stored as an integer to 10^5 precision."},
+	fluid.EntityFieldTypeAttribute: {Type: "object", AdditionalProperties: true},
+}
+
+// contractFieldOpenApiTypes maps every contract field type to an openapi type and format
+var contractFieldOpenApiTypes = map[string]OpenApiSchema{
+	fluid.ContractFieldTypeFile:     {Type: "string", Format: "binary"},
+	fluid.ContractFieldTypeBinary:   {Type: "string", Format: "binary"},
+	fluid.ContractFieldTypeString:   {Type: "string"},
+	fluid.ContractFieldTypeUuid:     {Type: "string", Format: "uuid"},
+	fluid.ContractFieldTypeDate:     {Type: "string", Format: "date"},
+	fluid.ContractFieldTypeDateTime: {Type: "string", Format: "date-time"},
+	fluid.ContractFieldTypeTime:     {Type: "string", Format: "time"},
+	fluid.ContractFieldTypeInteger:  {Type: "integer", Format: "int64"},
+	fluid.ContractFieldTypeDecimal:  {Type: "number", Format: "double"},
+	fluid.ContractFieldTypeBoolean:  {Type: "boolean"},
+	fluid.ContractFieldTypeMoney:    {Type: "integer", Format: "int64", Description: "Money stored as an integer to 10^5 precision."},
+}
+
+var attributeOpenApiTypes = map[string]OpenApiSchema{
+	AttributeTypeString:  {Type: "string"},
+	AttributeTypeInteger: {Type: "integer", Format: "int64"},
+	AttributeTypeDecimal: {Type: "number", Format: "double"},
+	AttributeTypeBoolean: {Type: "boolean"},
+}
+
+func openApiSchemaRef(name string) *OpenApiSchema {
+	return &OpenApiSchema{Ref: "#/components/schemas/" + name}
+}
+
+func openApiArray(schema *OpenApiSchema) *OpenApiSchema {
+	return &OpenApiSchema{Type: "array", Items: schema}
+}
+
+func entitySchemaName(entity fluid.Entity) string {
+	return pascalCase(entity.NameSingular)
+}
+
+func contractSchemaName(contract fluid.Contract) string {
+	return pascalCase(contract.Name) + pascalCase(contract.Type)
+}
+
+func entityFieldOpenApiSchema(field fluid.EntityField, constraint *AttributeConstraint) (*OpenApiSchema, error) {
+	base, ok := entityFieldOpenApiTypes[strings.ToLower(field.Type)]
+	if !ok {
+		return nil, fmt.Errorf("field '%s': entity field type '%s' has no openapi type mapping", field.Name, field.Type)
+	}
+
+	schema := base
+	schema.Title = field.Label
+	schema.Description = strings.TrimSpace(strings.TrimSpace(field.Description) + " " + base.Description)
+	schema.Pattern = field.Pattern
+	if field.DefaultValue != "" {
+		schema.Default = field.DefaultValue
+	}
+	if field.EnableOptionsSupport {
+		for _, option := range field.Options {
+			schema.Enum = append(schema.Enum, option.Value)
+		}
+	}
+	if field.NotEditable {
+		schema.ReadOnly = true
+	}
+	if constraint != nil {
+		schema.Properties = map[string]*OpenApiSchema{}
+		for _, key := range constraint.Keys {
+			keySchema := attributeOpenApiTypes[key.Type]
+			keySchema.Description = key.Description
+			schema.setProperty(key.Key, &keySchema)
+			if !key.IsOptional {
+				schema.Required = append(schema.Required, key.Key)
+			}
+		}
+		schema.AdditionalProperties = constraint.AllowOtherKeys
+	}
+
+	if field.EnableMultipleValueSupport {
+		items := schema
+		items.Description = ""
+		return &OpenApiSchema{Type: "array", Description: schema.Description, Items: &items, ReadOnly: schema.ReadOnly}, nil
+	}
+
+	if field.IsOptional {
+		schema.Nullable = true
+	}
+	return &schema, nil
+}
+
+func contractFieldOpenApiSchema(field fluid.ContractField) (*OpenApiSchema, error) {
+	base, ok := contractFieldOpenApiTypes[strings.ToLower(field.Type)]
+	if !ok {
+		return nil, fmt.Errorf("field '%s': contract field type '%s' has no openapi type mapping", field.Name, field.Type)
+	}
+
+	schema := base
+	schema.Title = field.Label
+	schema.Description = strings.TrimSpace(strings.TrimSpace(field.Description) + " " + base.Description)
+
+	if field.EnableMultipleValueSupport {
+		items := schema
+		items.Description = ""
+		return &OpenApiSchema{Type: "array", Description: schema.Description, Items: &items}, nil
+	}
+	return &schema, nil
+}
+
+func entityOpenApiSchema(entity fluid.Entity, extension EntityExtension) (*OpenApiSchema, error) {
+	schema := &OpenApiSchema{
+		Type:       "object",
+		Title:      titleCase(entity.NameSingular),
+		Properties: map[string]*OpenApiSchema{},
+	}
+
+	if !hasEntityIdField(entity) {
+		schema.setProperty("id", &OpenApiSchema{Type: "string", Description: "The unique identifier of the record.", ReadOnly: true})
+	}
+
+	for _, field := range entity.Fields {
+		var constraint *AttributeConstraint
+		if isAttributeField(field) {
+			constraint = extension.attributeConstraint(field)
+		}
+		property, err := entityFieldOpenApiSchema(field, constraint)
+		if err != nil {
+			return nil, err
+		}
+		schema.setProperty(camelCase(field.Name), property)
+		if !field.IsOptional {
+			schema.Required = append(schema.Required, camelCase(field.Name))
+		}
+	}
+
+	for _, link := range extension.Links {
+		property := &OpenApiSchema{Type: "string", Description: strings.TrimSpace(fmt.Sprintf("%s Links to '%s'.", link.Description, link.EntityKey))}
+		if link.IsMultiple() {
+			property = &OpenApiSchema{Type: "array", Description: property.Description, Items: &OpenApiSchema{Type: "string"}}
+		} else if link.IsOptional {
+			property.Nullable = true
+		}
+		schema.setProperty(camelCase(link.Name), property)
+		if !link.IsOptional {
+			schema.Required = append(schema.Required, camelCase(link.Name))
+		}
+	}
+
+	for _, field := range entityAuditFields(entity) {
+		property, err := entityFieldOpenApiSchema(field, nil)
+		if err != nil {
+			return nil, err
+		}
+		schema.setProperty(camelCase(field.Name), property)
+	}
+
+	return schema, nil
+}
+
+func contractOpenApiSchema(contract fluid.Contract) (*OpenApiSchema, error) {
+	schema := &OpenApiSchema{
+		Type:       "object",
+		Title:      titleCase(contract.Name),
+		Properties: map[string]*OpenApiSchema{},
+	}
+
+	for _, field := range append(contract.Fields, contractAuditFields(contract)...) {
+		property, err := contractFieldOpenApiSchema(field)
+		if err != nil {
+			return nil, err
+		}
+		schema.setProperty(camelCase(field.Name), property)
+	}
+
+	for _, field := range contract.Fields {
+		schema.Required = append(schema.Required, camelCase(field.Name))
+	}
+
+	return schema, nil
+}
+
+// withArticle prefixes a lower case noun with its indefinite article
+func withArticle(noun string) string {
+	if noun != "" && strings.ContainsRune("aeiou", rune(noun[0])) {
+		return "an " + noun
+	}
+	return "a " + noun
+}
+
+func findContract(project fluid.Project, key string) (fluid.Contract, bool) {
+	for _, contract := range project.Contracts {
+		if contract.Key == key {
+			return contract, true
+		}
+	}
+	return fluid.Contract{}, false
+}
+
+func openApiSecurity(disabled bool) []map[string][]string {
+	if disabled {
+		return []map[string][]string{}
+	}
+	return []map[string][]string{{openApiBearerAuth: {}}}
+}
+
+func openApiJson(schema *OpenApiSchema) map[string]OpenApiMediaType {
+	return map[string]OpenApiMediaType{"application/json": {Schema: schema}}
+}
+
+func openApiAddOperation(document *OpenApi, path, method string, operation *OpenApiOperation) {
+	item, ok := document.Paths[path]
+	if !ok {
+		item = OpenApiPathItem{}
+		document.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = operation
+}
+
+// entityActionPath returns the route of an action, list actions apply to the collection and record actions to a single record
+func entityActionPath(entity fluid.Entity, action fluid.EntityAction) string {
+	if strings.ToLower(action.Type) == fluid.EntityActionTypeRecord {
+		return fmt.Sprintf("/%s/{id}/%s", kebabCase(entity.NamePlural), kebabCase(action.Name))
+	}
+	return fmt.Sprintf("/%s/actions/%s", kebabCase(entity.NamePlural), kebabCase(action.Name))
+}
+
+var openApiIdParameter = OpenApiParameter{
+	Name:        "id",
+	In:          "path",
+	Description: "The unique identifier of the record.",
+	Required:    true,
+	Schema:      &OpenApiSchema{Type: "string"},
+}
+
+func entityListParameters(entity fluid.Entity) []OpenApiParameter {
+	minimum := 1
+	parameters := []OpenApiParameter{
+		{Name: "page", In: "query", Description: "The page number, starting at 1.", Schema: &OpenApiSchema{Type: "integer", Minimum: &minimum, Default: 1}},
+		{Name: "pageSize", In: "query", Description: "The number of records per page.", Schema: &OpenApiSchema{Type: "integer", Minimum: &minimum, Default: 10}},
+		{Name: "sort", In: "query", Description: "The field to sort by, prefix with '-' for descending order.", Schema: &OpenApiSchema{Type: "string"}},
+	}
+	if entity.EnableFreeTextSearch {
+		parameters = append(parameters, OpenApiParameter{Name: "search", In: "query", Description: "Free text to search for.", Schema: &OpenApiSchema{Type: "string"}})
+	}
+	return parameters
+}
+
+func buildEntityOperations(document *OpenApi, project fluid.Project, entity fluid.Entity) error {
+	slug := kebabCase(entity.NamePlural)
+	tag := titleCase(entity.NamePlural)
+	ref := openApiSchemaRef(entitySchemaName(entity))
+	collectionPath := "/" + slug
+	recordPath := fmt.Sprintf("/%s/{id}", slug)
+	notFound := OpenApiResponse{Description: fmt.Sprintf("The %s does not exist.", strings.ToLower(titleCase(entity.NameSingular)))}
+
+	if !entity.DisableList {
+		openApiAddOperation(document, collectionPath, http.MethodGet, &OpenApiOperation{
+			OperationId: camelCase("list " + entity.NamePlural),
+			Summary:     fmt.Sprintf("List %s", strings.ToLower(titleCase(entity.NamePlural))),
+			Tags:        []string{tag},
+			Parameters:  entityListParameters(entity),
+			Responses: map[string]OpenApiResponse{
+				"200": {Description: fmt.Sprintf("A page of %s.", strings.ToLower(titleCase(entity.NamePlural))), Content: openApiJson(openApiArray(ref))},
+			},
+			Security: openApiSecurity(false),
+		})
+	}
+
+	if !entity.DisableCreate {
+		openApiAddOperation(document, collectionPath, http.MethodPost, &OpenApiOperation{
+			OperationId: camelCase("create " + entity.NameSingular),
+			Summary:     fmt.Sprintf("Create %s", withArticle(strings.ToLower(titleCase(entity.NameSingular)))),
+			Tags:        []string{tag},
+			RequestBody: &OpenApiRequestBody{Required: true, Content: openApiJson(ref)},
+			Responses: map[string]OpenApiResponse{
+				"201": {Description: fmt.Sprintf("The created %s.", strings.ToLower(titleCase(entity.NameSingular))), Content: openApiJson(ref)},
+			},
+			Security: openApiSecurity(false),
+		})
+	}
+
+	openApiAddOperation(document, recordPath, http.MethodGet, &OpenApiOperation{
+		OperationId: camelCase("read " + entity.NameSingular),
+		Summary:     fmt.Sprintf("Read %s", withArticle(strings.ToLower(titleCase(entity.NameSingular)))),
+		Tags:        []string{tag},
+		Parameters:  []OpenApiParameter{openApiIdParameter},
+		Responses: map[string]OpenApiResponse{
+			"200": {Description: fmt.Sprintf("The %s.", strings.ToLower(titleCase(entity.NameSingular))), Content: openApiJson(ref)},
+			"404": notFound,
+		},
+		Security: openApiSecurity(false),
+	})
+
+	if !entity.DisableUpdate {
+		openApiAddOperation(document, recordPath, http.MethodPut, &OpenApiOperation{
+			OperationId: camelCase("update " + entity.NameSingular),
+			Summary:     fmt.Sprintf("Update %s", withArticle(strings.ToLower(titleCase(entity.NameSingular)))),
+			Tags:        []string{tag},
+			Parameters:  []OpenApiParameter{openApiIdParameter},
+			RequestBody: &OpenApiRequestBody{Required: true, Content: openApiJson(ref)},
+			Responses: map[string]OpenApiResponse{
+				"200": {Description: fmt.Sprintf("The updated %s.", strings.ToLower(titleCase(entity.NameSingular))), Content: openApiJson(ref)},
+				"404": notFound,
+			},
+			Security: openApiSecurity(false),
+		})
+	}
+
+	if !entity.DisableDelete {
+		openApiAddOperation(document, recordPath, http.MethodDelete, &OpenApiOperation{
+			OperationId: camelCase("delete " + entity.NameSingular),
+			Summary:     fmt.Sprintf("Delete %s", withArticle(strings.ToLower(titleCase(entity.NameSingular)))),
+			Tags:        []string{tag},
+			Parameters:  []OpenApiParameter{openApiIdParameter},
+			Responses: map[string]OpenApiResponse{
+				"204": {Description: fmt.Sprintf("The %s was deleted.", strings.ToLower(titleCase(entity.NameSingular)))},
+				"404": notFound,
+			},
+			Security: openApiSecurity(false),
+		})
+	}
+
+	for _, action := range entity.Actions {
+		operation := &OpenApiOperation{
+			OperationId: camelCase(fmt.Sprintf("%s %s", action.Name, entity.NamePlural)),
+			Summary:     titleCase(action.Name),
+			Description: action.Description,
+			Tags:        []string{tag},
+			Responses:   map[string]OpenApiResponse{},
+			Security:    openApiSecurity(action.DisableAuthorizationRequirement),
+		}
+
+		if strings.ToLower(action.Type) == fluid.EntityActionTypeRecord {
+			operation.Parameters = append(operation.Parameters, openApiIdParameter)
+		}
+
+		if action.RequestParametersContractKey != "" {
+			contract, ok := findContract(project, action.RequestParametersContractKey)
+			if !ok {
+				return validationError(fmt.Errorf("action '%s': contract '%s' does not exist", action.Name, action.RequestParametersContractKey))
+			}
+			for _, field := range contract.Fields {
+				schema, err := contractFieldOpenApiSchema(field)
+				if err != nil {
+					return fmt.Errorf("action '%s': %w", action.Name, err)
+				}
+				operation.Parameters = append(operation.Parameters, OpenApiParameter{
+					Name:        camelCase(field.Name),
+					In:          "query",
+					Description: field.Description,
+					Schema:      schema,
+				})
+			}
+		}
+
+		if action.RequestBodyContractKey != "" {
+			contract, ok := findContract(project, action.RequestBodyContractKey)
+			if !ok {
+				return validationError(fmt.Errorf("action '%s': contract '%s' does not exist", action.Name, action.RequestBodyContractKey))
+			}
+			mediaType := "application/json"
+			for _, field := range contract.Fields {
+				if strings.ToLower(field.Type) == fluid.ContractFieldTypeFile {
+					mediaType = "multipart/form-data"
+				}
+			}
+			operation.RequestBody = &OpenApiRequestBody{
+				Required: true,
+				Content:  map[string]OpenApiMediaType{mediaType: {Schema: openApiSchemaRef(contractSchemaName(contract))}},
+			}
+		}
+
+		switch {
+		case action.EnableFileDownloadResponse:
+			operation.Responses["200"] = OpenApiResponse{
+				Description: "The file to download.",
+				Headers: map[string]OpenApiHeader{
+					"Content-Disposition": {Description: "The name of the downloaded file.", Schema: &OpenApiSchema{Type: "string"}},
+				},
+				Content: map[string]OpenApiMediaType{"application/octet-stream": {Schema: &OpenApiSchema{Type: "string", Format: "binary"}}},
+			}
+		case action.ResponseBodyContractKey != "":
+			contract, ok := findContract(project, action.ResponseBodyContractKey)
+			if !ok {
+				return validationError(fmt.Errorf("action '%s': contract '%s' does not exist", action.Name, action.ResponseBodyContractKey))
+			}
+			operation.Responses["200"] = OpenApiResponse{Description: "Success.", Content: openApiJson(openApiSchemaRef(contractSchemaName(contract)))}
+		default:
+			operation.Responses["204"] = OpenApiResponse{Description: "Success."}
+		}
+
+		if strings.ToLower(action.Type) == fluid.EntityActionTypeRecord {
+			operation.Responses["404"] = notFound
+		}
+
+		path := entityActionPath(entity, action)
+		if _, exists := document.Paths[path][strings.ToLower(action.Method)]; exists {
+			return validationError(fmt.Errorf("action '%s': %s %s is routed more than once", action.Name, strings.ToUpper(action.Method), path))
+		}
+		openApiAddOperation(document, path, strings.ToUpper(action.Method), operation)
+	}
+
+	return nil
+}
+
+var buildOpenApi = func(project fluid.Project, extensions ProjectExtensions) (*OpenApi, error) {
+	document := &OpenApi{
+		OpenApi: openApiVersion,
+		Info: OpenApiInfo{
+			Title:       project.Name,
+			Description: project.Description,
+			Version:     project.Version,
+		},
+		Paths: map[string]OpenApiPathItem{},
+		Components: OpenApiComponents{
+			Schemas: map[string]*OpenApiSchema{},
+			SecuritySchemes: map[string]OpenApiSecurityScheme{
+				openApiBearerAuth: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+	}
+
+	// component schema names are derived from entity and contract names, two of them may not end up with the same one
+	owners := map[string]string{}
+	claimSchemaName := func(name, owner string) error {
+		if previous, ok := owners[name]; ok {
+			return validationError(fmt.Errorf("%s: component schema '%s' is already used by %s", owner, name, previous))
+		}
+		owners[name] = owner
+		return nil
+	}
+
+	for _, entity := range project.Entities {
+		if err := claimSchemaName(entitySchemaName(entity), fmt.Sprintf("entity '%s'", entity.NameSingular)); err != nil {
+			return nil, err
+		}
+		schema, err := entityOpenApiSchema(entity, extensions.entity(entity))
+		if err != nil {
+			return nil, fmt.Errorf("entity '%s': %w", entity.NameSingular, err)
+		}
+		document.Components.Schemas[entitySchemaName(entity)] = schema
+		document.Tags = append(document.Tags, OpenApiTag{Name: titleCase(entity.NamePlural)})
+
+		if err := buildEntityOperations(document, project, entity); err != nil {
+			return nil, fmt.Errorf("entity '%s': %w", entity.NameSingular, err)
+		}
+	}
+
+	for _, contract := range project.Contracts {
+		if err := claimSchemaName(contractSchemaName(contract), fmt.Sprintf("contract '%s'", contract.Key)); err != nil {
+			return nil, err
+		}
+		schema, err := contractOpenApiSchema(contract)
+		if err != nil {
+			return nil, fmt.Errorf("contract '%s': %w", contract.Key, err)
+		}
+		document.Components.Schemas[contractSchemaName(contract)] = schema
+	}
+
+	return document, nil
+}
+
+var writeOpenApiJson = func(document *OpenApi, directory string) error {
+	openApiJsonData, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	openApiJsonFilePath := filepath.Join(directory, "openapi.json")
+	if err := ioutil.WriteFile(openApiJsonFilePath, openApiJsonData, os.ModePerm); err != nil {
+		return ioError(err)
+	}
+	return nil
+}
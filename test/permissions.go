@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-fluid/fluid"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const (
+	PermissionList   = "list"
+	PermissionCreate = "create"
+	PermissionRead   = "read"
+	PermissionUpdate = "update"
+	PermissionDelete = "delete"
+)
+
+var crudPermissions = []string{PermissionList, PermissionCreate, PermissionRead, PermissionUpdate, PermissionDelete}
+
+// entityPermission is whether an account type may perform a crud operation or action on an entity
+type entityPermission struct {
+	Key     string
+	Allowed bool
+}
+
+// accountPermissions holds the permissions of one account type on one entity
+type accountPermissions struct {
+	AccountType string
+	Crud        []entityPermission
+	Actions     []entityPermission
+}
+
+// entityPermissions holds the permissions of every account type of a portal on one entity
+type entityPermissions struct {
+	Entity   string
+	Accounts []accountPermissions
+}
+
+// isDisabledPermission reports whether the entity switches a crud operation off for everyone
+func isDisabledPermission(entity fluid.Entity, permission string) bool {
+	switch permission {
+	case PermissionList:
+		return entity.DisableList
+	case PermissionCreate:
+		return entity.DisableCreate
+	case PermissionUpdate:
+		return entity.DisableUpdate
+	case PermissionDelete:
+		return entity.DisableDelete
+	}
+	return false
+}
+
+// newAccountPermissions allows the permissions the entity lists for the account type and denies everything else, an entity
+// without permissions is only open to the account type of a portal that has a single one
+func newAccountPermissions(entity fluid.Entity, extension EntityExtension, accountType string, isOnlyAccountType bool) accountPermissions {
+	var listed []string
+	isListed := false
+	for key, permissions := range extension.Permissions {
+		if kebabCase(key) == accountType {
+			listed, isListed = permissions, true
+		}
+	}
+	allowed := func(permission string) bool {
+		if !isListed {
+			return isOnlyAccountType && len(extension.Permissions) == 0
+		}
+		for _, value := range listed {
+			if kebabCase(value) == permission {
+				return true
+			}
+		}
+		return false
+	}
+
+	permissions := accountPermissions{AccountType: accountType}
+	for _, permission := range crudPermissions {
+		permissions.Crud = append(permissions.Crud, entityPermission{
+			Key:     permission,
+			Allowed: allowed(permission) && !isDisabledPermission(entity, permission),
+		})
+	}
+	for _, action := range entity.Actions {
+		permissions.Actions = append(permissions.Actions, entityPermission{
+			Key:     kebabCase(action.Name),
+			Allowed: allowed(kebabCase(action.Name)),
+		})
+	}
+	return permissions
+}
+
+func portalAccountTypes(portal fluid.Portal) []string {
+	accountTypes := make([]string, 0, len(portal.AccountEntityKeys))
+	for _, key := range portal.AccountEntityKeys {
+		accountTypes = append(accountTypes, kebabCase(key))
+	}
+	return accountTypes
+}
+
+func validatePermissions(project fluid.Project, extensions ProjectExtensions) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	accountTypes := map[string]bool{}
+	for i, portal := range project.Portals {
+		for j, key := range portal.AccountEntityKeys {
+			if _, ok := findEntity(project, key); !ok {
+				diagnostics = append(diagnostics, Diagnostic{Path: fmt.Sprintf("/portals/%d/accountEntityKeys/%d", i, j), Severity: SeverityError, Message: fmt.Sprintf("entity '%s' does not exist", key)})
+			}
+			accountTypes[kebabCase(key)] = true
+		}
+	}
+
+	for i, entity := range project.Entities {
+		permissions := map[string]bool{}
+		for _, permission := range crudPermissions {
+			permissions[permission] = true
+		}
+		for _, action := range entity.Actions {
+			permissions[kebabCase(action.Name)] = true
+		}
+
+		extension := extensions.entity(entity)
+		var accountTypeKeys []string
+		for accountType := range extension.Permissions {
+			accountTypeKeys = append(accountTypeKeys, accountType)
+		}
+		sort.Strings(accountTypeKeys)
+
+		for _, accountType := range accountTypeKeys {
+			pointer := fmt.Sprintf("/entities/%d/permissions/%s", i, accountType)
+			if !accountTypes[kebabCase(accountType)] {
+				diagnostics = append(diagnostics, Diagnostic{Path: pointer, Severity: SeverityError, Message: fmt.Sprintf("'%s' is not an account entity of any portal", accountType)})
+			}
+			for j, permission := range extension.Permissions[accountType] {
+				if !permissions[kebabCase(permission)] {
+					diagnostics = append(diagnostics, Diagnostic{
+						Path:     fmt.Sprintf("%s/%d", pointer, j),
+						Severity: SeverityError,
+						Message:  fmt.Sprintf("'%s' is not a permission of entity '%s', expected a crud operation (%s) or action", permission, entity.NameSingular, strings.Join(crudPermissions, ", ")),
+					})
+				}
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+const permissionsFileTemplate = `export const accountTypes: string[] = [{{range AccountTypes}}
+  '{{ . }}',{{end}}
+];
+
+export interface EntityPermissions {
+  list: boolean;
+  create: boolean;
+  read: boolean;
+  update: boolean;
+  delete: boolean;
+  actions: {[action: string]: boolean};
+}
+
+export const permissions: {[entity: string]: {[accountType: string]: EntityPermissions}} = {
+{{range .}}  {{ .Entity }}: {
+{{range .Accounts}}    '{{ .AccountType }}': {
+{{range .Crud}}      {{ .Key }}: {{ .Allowed }},
+{{end}}      actions: {
+{{range .Actions}}        '{{ .Key }}': {{ .Allowed }},
+{{end}}      },
+    },
+{{end}}  },
+{{end}}};
+`
+
+// buildPermissionsFile writes the permissions module imported by the repositories of a portal
+var buildPermissionsFile = func(project fluid.Project, extensions ProjectExtensions, portal fluid.Portal, directory string) error {
+	if _, ok := findEntity(project, "permissions"); ok {
+		return validationError(fmt.Errorf("entity 'permissions' clashes with the generated permissions module"))
+	}
+
+	accountTypes := portalAccountTypes(portal)
+
+	var permissions []entityPermissions
+	for _, entity := range project.Entities {
+		entityPermission := entityPermissions{Entity: camelCase(entity.NamePlural)}
+		for _, accountType := range accountTypes {
+			entityPermission.Accounts = append(entityPermission.Accounts, newAccountPermissions(entity, extensions.entity(entity), accountType, len(accountTypes) == 1))
+		}
+		permissions = append(permissions, entityPermission)
+	}
+
+	permissionsFilePath := filepath.Join(directory, "permissions.ts")
+	permissionsFile, err := os.Create(permissionsFilePath)
+	if err != nil {
+		return ioError(err)
+	}
+
+	defer func() { _ = permissionsFile.Close() }()
+
+	tmpl, err := template.New("permissions").Funcs(
+		template.FuncMap{
+			"AccountTypes": func() []string {
+				return accountTypes
+			},
+		},
+	).Parse(
+		permissionsFileTemplate,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := tmpl.Execute(permissionsFile, permissions); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-fluid/fluid"
+	"strconv"
+	"strings"
+)
+
+// portalOption is a single typescript property set on a repository field, Value is a typescript literal
+type portalOption struct {
+	Key   string
+	Value string
+}
+
+// portalFieldType is the portal representation of a schema field type along with the input options it needs
+type portalFieldType struct {
+	ValueType string
+	Options   []portalOption
+}
+
+// entityFieldPortalTypes maps every entity field type to the value type and input options used by the portal repositories
+var entityFieldPortalTypes = map[string]portalFieldType{
+	fluid.EntityFieldTypePassword:  {ValueType: "EnumValueType.Password", Options: []portalOption{{Key: "masked", Value: "true"}}},
+	fluid.EntityFieldTypeBinary:    {ValueType: "EnumValueType.File"},
+	fluid.EntityFieldTypeString:    {ValueType: "EnumValueType.Text"},
+	fluid.EntityFieldTypeUuid:      {ValueType: "EnumValueType.Text"},
+	fluid.EntityFieldTypeDate:      {ValueType: "EnumValueType.Date", Options: []portalOption{{Key: "picker", Value: "'date'"}}},
+	fluid.EntityFieldTypeDateTime:  {ValueType: "EnumValueType.DateTime", Options: []portalOption{{Key: "picker", Value: "'date-time'"}}},
+	fluid.EntityFieldTypeTime:      {ValueType: "EnumValueType.Time", Options: []portalOption{{Key: "picker", Value: "'time'"}}},
+	fluid.EntityFieldTypeInteger:   {ValueType: "EnumValueType.Integer", Options: []portalOption{{Key: "input", Value: "'number'"}, {Key: "step", Value: "1"}}},
+	fluid.EntityFieldTypeDecimal:   {ValueType: "EnumValueType.Decimal", Options: []portalOption{{Key: "input", Value: "'number'"}}},
+	fluid.EntityFieldTypeBoolean:   {ValueType: "EnumValueType.Boolean", Options: []portalOption{{Key: "input", Value: "'checkbox'"}}},
+	fluid.EntityFieldTypeMoney:     {ValueType: "EnumValueType.Money", Options: []portalOption{{Key: "input", Value: "'number'"}, {Key: "precision", Value: "5"}}}, // stored as an integer to 10^5 precision
+	fluid.EntityFieldTypeAttribute: {ValueType: "EnumValueType.Attributes"},
+}
+
+func lookupPortalType(fieldType string) (portalFieldType, error) {
+	if t, ok := entityFieldPortalTypes[strings.ToLower(fieldType)]; ok {
+		return t, nil
+	}
+	return portalFieldType{}, fmt.Errorf("entity field type '%s' has no portal type mapping", fieldType)
+}
+
+// entityFieldPortalType returns the portal type of a field along with the options derived from the field itself
+func entityFieldPortalType(field fluid.EntityField) (portalFieldType, error) {
+	t, err := lookupPortalType(field.Type)
+	if err != nil {
+		return t, fmt.Errorf("field '%s': %w", field.Name, err)
+	}
+
+	options := append([]portalOption{}, t.Options...)
+	if field.EnableMultipleValueSupport {
+		options = append(options, portalOption{Key: "multiple", Value: "true"})
+	}
+	if field.IsOptional {
+		options = append(options, portalOption{Key: "optional", Value: "true"})
+	}
+	if field.NotEditable {
+		options = append(options, portalOption{Key: "readonly", Value: "true"})
+	}
+	if field.Hint != "" {
+		options = append(options, portalOption{Key: "hint", Value: tsString(field.Hint)})
+	}
+
+	return portalFieldType{ValueType: t.ValueType, Options: options}, nil
+}
+
+// checkPortalTypes fails generation early for fields the portal cannot render
+func checkPortalTypes(entity fluid.Entity) error {
+	for _, field := range append(entity.Fields, entityAuditFields(entity)...) {
+		if _, err := entityFieldPortalType(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tsString quotes a value as a single quoted typescript string
+func tsString(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return "'" + value + "'"
+}
+
+// tsLiteral renders an option value as a typescript literal, options are either integers or strings
+func tsLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return tsString(fmt.Sprint(value))
+}
+
+// defaultSectionTitle is the title of the section holding fields without a group
+const defaultSectionTitle = "General"
+
+// portalSection is a form section of a portal repository with the keys of its fields in schema order
+type portalSection struct {
+	Key    string
+	Title  string
+	Fields []string
+}
+
+// entitySections groups the fields and links of an entity into sections in the order their groups first appear,
+// groups are matched on their title case so differently cased groups share a section
+func entitySections(entity fluid.Entity, links []resolvedLink) []portalSection {
+	var sections []portalSection
+	indexes := map[string]int{}
+
+	add := func(group, name string) {
+		title := titleCase(strings.TrimSpace(group))
+		if title == "" {
+			title = defaultSectionTitle
+		}
+		index, ok := indexes[title]
+		if !ok {
+			index = len(sections)
+			indexes[title] = index
+			sections = append(sections, portalSection{Key: kebabCase(title), Title: title})
+		}
+		sections[index].Fields = append(sections[index].Fields, camelCase(name))
+	}
+
+	for _, field := range entity.Fields {
+		add(field.Group, field.Name)
+	}
+	for _, link := range links {
+		add(link.Group, link.Name)
+	}
+
+	return sections
+}
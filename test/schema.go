@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SchemaError describes a problem found while decoding a schema file, located by line and column where possible
+type SchemaError struct {
+	Path   string
+	Line   int
+	Column int
+	Err    error
+
+	key   []string // schema keys leading to the error, used to relocate errors for non-json formats
+	field string   // name of an unknown field, its position in the schema is not known
+}
+
+func (e *SchemaError) Error() string {
+	if e.Line <= 0 {
+		return fmt.Sprintf("%s: %s", e.Path, e.Err)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.Path, e.Line, e.Column, e.Err)
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	SchemaFormatJson = "json"
+	SchemaFormatYaml = "yaml"
+	SchemaFormatToml = "toml"
+)
+
+var unknownFieldPattern = regexp.MustCompile(`^json: unknown field "(.*)"$`)
+
+// schemaFormat resolves the format of a schema file, an explicit format takes precedence over the file extension
+func schemaFormat(path, format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			format = SchemaFormatYaml
+		case ".toml":
+			format = SchemaFormatToml
+		default:
+			format = SchemaFormatJson
+		}
+	}
+
+	switch format {
+	case SchemaFormatJson, SchemaFormatYaml, SchemaFormatToml:
+		return format, nil
+	case "yml":
+		return SchemaFormatYaml, nil
+	}
+
+	return "", usageError(fmt.Errorf("schema format '%s' not supported", format))
+}
+
+// loadSchema reads a project schema from the given path, "-" reads from stdin and an empty path returns the built-in fluid project scheme
+var loadSchema = func(path, format string) (*SchemaDocument, error) {
+	if strings.TrimSpace(path) == "" {
+		return &SchemaDocument{Project: fluidProjectScheme}, nil
+	}
+
+	format, err := schemaFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if path == "-" {
+		workingDirectory, err := os.Getwd()
+		if err != nil {
+			return nil, ioError(err)
+		}
+		return readSchema("<stdin>", format, workingDirectory, os.Stdin)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, ioError(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	return readSchema(path, format, filepath.Dir(path), file)
+}
+
+// readSchema decodes a root schema and merges in any included files, include patterns are resolved relative to directory
+var readSchema = func(name, format, directory string, reader io.Reader) (*SchemaDocument, error) {
+	var root rootSchema
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, ioError(fmt.Errorf("%s: %w", name, err))
+	}
+
+	if err := decodeSchema(name, format, data, &root); err != nil {
+		return nil, err
+	}
+
+	return composeSchema(schemaFile{Path: name, Format: format, Data: data}, directory, root)
+}
+
+var decodeSchema = func(name, format string, data []byte, model interface{}) error {
+	switch format {
+	case SchemaFormatYaml:
+		return decodeYamlSchema(name, data, model)
+	case SchemaFormatToml:
+		return decodeTomlSchema(name, data, model)
+	}
+	return decodeJsonSchema(name, data, model)
+}
+
+// decodeYamlSchema converts yaml to json before decoding so that yaml schemas share the json field names and strictness
+var decodeYamlSchema = func(name string, data []byte, model interface{}) error {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		var typeError *yaml.TypeError
+		if errors.As(err, &typeError) {
+			return &SchemaError{Path: name, Err: errors.New(strings.Join(typeError.Errors, "; "))}
+		}
+		return yamlSchemaError(name, err)
+	}
+
+	var value interface{}
+	if err := document.Decode(&value); err != nil {
+		return &SchemaError{Path: name, Err: err}
+	}
+
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return &SchemaError{Path: name, Err: err}
+	}
+
+	err = decodeJsonSchema(name, jsonData, model)
+	var schemaError *SchemaError
+	if errors.As(err, &schemaError) {
+		// json positions are meaningless for yaml so relocate the error using the yaml document instead
+		schemaError.Line, schemaError.Column = 0, 0
+		key := schemaError.key
+		if key == nil && schemaError.field != "" {
+			key = []string{schemaError.field}
+		}
+		if key != nil {
+			if node := findYamlNode(&document, key); node != nil {
+				schemaError.Line, schemaError.Column = node.Line, node.Column
+			}
+		}
+	}
+	return err
+}
+
+var yamlErrorPattern = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+func yamlSchemaError(name string, err error) error {
+	if matches := yamlErrorPattern.FindStringSubmatch(err.Error()); matches != nil {
+		line, _ := strconv.Atoi(matches[1])
+		return &SchemaError{Path: name, Line: line, Column: 1, Err: errors.New(matches[2])}
+	}
+	return &SchemaError{Path: name, Err: err}
+}
+
+// findYamlNode walks the yaml document along the given path of keys and sequence indexes, a single key is searched for anywhere in the document
+func findYamlNode(node *yaml.Node, path []string) *yaml.Node {
+	if node == nil || len(path) <= 0 {
+		return nil
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) > 0 {
+			return findYamlNode(node.Content[0], path)
+		}
+	case yaml.SequenceNode:
+		if index, err := strconv.Atoi(path[0]); err == nil {
+			if index < 0 || index >= len(node.Content) {
+				return nil
+			}
+			if len(path) == 1 {
+				return node.Content[index]
+			}
+			return findYamlNode(node.Content[index], path[1:])
+		}
+		for _, child := range node.Content {
+			if found := findYamlNode(child, path); found != nil {
+				return found
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value != path[0] {
+				continue
+			}
+			if len(path) == 1 {
+				return node.Content[i]
+			}
+			return findYamlNode(node.Content[i+1], path[1:])
+		}
+		if len(path) == 1 {
+			for i := 1; i < len(node.Content); i += 2 {
+				if found := findYamlNode(node.Content[i], path); found != nil {
+					return found
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+var tomlErrorPrefixPattern = regexp.MustCompile(`^toml: line \d+( \(last key .*\))?: `)
+
+// decodeTomlSchema converts toml to json before decoding so that toml schemas share the json field names and strictness
+var decodeTomlSchema = func(name string, data []byte, model interface{}) error {
+	var value map[string]interface{}
+	if _, err := toml.Decode(string(data), &value); err != nil {
+		var parseError toml.ParseError
+		if errors.As(err, &parseError) {
+			message := tomlErrorPrefixPattern.ReplaceAllString(parseError.Error(), "")
+			return newSchemaError(name, data, int64(parseError.Position.Start), errors.New(message))
+		}
+		return &SchemaError{Path: name, Err: err}
+	}
+
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return &SchemaError{Path: name, Err: err}
+	}
+
+	err = decodeJsonSchema(name, jsonData, model)
+	var schemaError *SchemaError
+	if errors.As(err, &schemaError) {
+		// the toml decoder does not expose key positions so json positions are dropped rather than reported incorrectly
+		schemaError.Line, schemaError.Column = 0, 0
+	}
+	return err
+}
+
+var decodeJsonSchema = func(name string, data []byte, model interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(model); err != nil {
+		return jsonSchemaError(name, data, err)
+	}
+
+	if decoder.More() {
+		offset := decoder.InputOffset() + int64(len(data[decoder.InputOffset():])-len(bytes.TrimLeft(data[decoder.InputOffset():], " \t\r\n")))
+		return newSchemaError(name, data, offset, errors.New("unexpected data after the top-level object"))
+	}
+
+	return nil
+}
+
+func jsonSchemaError(name string, data []byte, err error) error {
+	// syntax and type error offsets point just past the offending byte
+	var syntaxError *json.SyntaxError
+	if errors.As(err, &syntaxError) {
+		return newSchemaError(name, data, syntaxError.Offset-1, err)
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		schemaError := newSchemaError(name, data, typeError.Offset-1, fmt.Errorf("field '%s' expects a %s but got a %s", typeError.Field, typeError.Type, typeError.Value))
+		schemaError.key = strings.Split(typeError.Field, ".")
+		return schemaError
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return newSchemaError(name, data, int64(len(data)), errors.New("unexpected end of schema"))
+	}
+
+	if matches := unknownFieldPattern.FindStringSubmatch(err.Error()); matches != nil {
+		// the decoder does not report where an unknown field was found so we locate the first matching key instead
+		offset := int64(-1)
+		if location := regexp.MustCompile(regexp.QuoteMeta(fmt.Sprintf("%q", matches[1])) + `\s*:`).FindIndex(data); location != nil {
+			offset = int64(location[0]) + 1
+		}
+		schemaError := newSchemaError(name, data, offset, fmt.Errorf("unknown field '%s'", matches[1]))
+		schemaError.field = matches[1]
+		return schemaError
+	}
+
+	return &SchemaError{Path: name, Err: err}
+}
+
+func newSchemaError(name string, data []byte, offset int64, err error) *SchemaError {
+	line, column := offsetToPosition(data, offset)
+	return &SchemaError{
+		Path:   name,
+		Line:   line,
+		Column: column,
+		Err:    err,
+	}
+}
+
+// offsetToPosition converts a byte offset into a one based line and column, a negative offset yields zero values
+func offsetToPosition(data []byte, offset int64) (line int, column int) {
+	if offset < 0 {
+		return 0, 0
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	line = 1
+	column = 1
+	for _, b := range data[:offset] {
+		if b == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return
+}
@@ -0,0 +1,2 @@
+// Package contracts holds the request, response and parameter contracts generated from the schema
+package contracts
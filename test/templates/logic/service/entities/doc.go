@@ -0,0 +1,2 @@
+// Package entities holds the entities generated from the schema
+package entities
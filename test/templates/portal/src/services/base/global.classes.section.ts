@@ -0,0 +1,4 @@
+export class Section {
+  constructor(public key: string, public title: string, public fields: string[]) {
+  }
+}
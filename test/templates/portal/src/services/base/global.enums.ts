@@ -0,0 +1,20 @@
+export enum EnumValueType {
+  Text = 'text',
+  Password = 'password',
+  File = 'file',
+  Date = 'date',
+  DateTime = 'date-time',
+  Time = 'time',
+  Integer = 'integer',
+  Decimal = 'decimal',
+  Boolean = 'boolean',
+  Money = 'money',
+  Attributes = 'attributes',
+  Link = 'link',
+}
+
+export enum EnumHeaderAlign {
+  Start = 'start',
+  Center = 'center',
+  End = 'end',
+}
@@ -0,0 +1,55 @@
+import {EnumHeaderAlign, EnumValueType} from '@/services/base/global.enums';
+import {Section} from '@/services/base/global.classes.section';
+import {EntityPermissions} from '@/services/repositories/permissions';
+
+export interface RepositoryOptions {
+  freeTextSearch: boolean;
+  disableCreation: boolean;
+}
+
+export interface Field {
+  type: EnumValueType;
+  [option: string]: any;
+}
+
+export interface Header {
+  fieldKey: string;
+  align: EnumHeaderAlign;
+  sortable: boolean;
+  width?: string;
+}
+
+export interface Action {
+  color: string;
+  icon: string;
+  title: string;
+  key: string;
+  action?: {
+    method: string;
+    path: string;
+    download: boolean;
+  };
+}
+
+export class Repository<T> {
+  fields: {[key: string]: Field} = {};
+  headers: Header[] = [];
+  sections: Section[] = [];
+  recordActions: Action[] = [];
+  bulkActions: Action[] = [];
+
+  constructor(public slug: string, public permissions: {[accountType: string]: EntityPermissions}, public options: RepositoryOptions) {
+  }
+
+  addField(key: keyof T & string, field: Field) {
+    this.fields[key] = field;
+  }
+
+  setHeaders(headers: Header[]) {
+    this.headers = headers;
+  }
+
+  setSections(sections: Section[]) {
+    this.sections = sections;
+  }
+}
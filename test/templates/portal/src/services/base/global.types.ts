@@ -0,0 +1,6 @@
+export type Attributes = {[key: string]: string | number | boolean};
+
+export interface Link {
+  id: string;
+  text?: string;
+}
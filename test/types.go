@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-fluid/fluid"
+	"sort"
+	"strings"
+)
+
+const (
+	goImportTime      = "time"
+	goImportPrimitive = "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// goType is the go representation of a schema field type along with the package it needs
+type goType struct {
+	Name   string
+	Import string
+}
+
+// entityFieldGoTypes maps every entity field type to the go type used in the logic service entities
+var entityFieldGoTypes = map[string]goType{
+	fluid.EntityFieldTypePassword:  {Name: "string"},
+	fluid.EntityFieldTypeBinary:    {Name: "[]byte"},
+	fluid.EntityFieldTypeString:    {Name: "string"},
+	fluid.EntityFieldTypeUuid:      {Name: "string"},
+	fluid.EntityFieldTypeDate:      {Name: "time.Time", Import: goImportTime},
+	fluid.EntityFieldTypeDateTime:  {Name: "time.Time", Import: goImportTime},
+	fluid.EntityFieldTypeTime:      {Name: "time.Time", Import: goImportTime},
+	fluid.EntityFieldTypeInteger:   {Name: "int64"},
+	fluid.EntityFieldTypeDecimal:   {Name: "float64"},
+	fluid.EntityFieldTypeBoolean:   {Name: "bool"},
+	fluid.EntityFieldTypeMoney:     {Name: "int64"}, // stored as an integer to 10^5 precision
+	fluid.EntityFieldTypeAttribute: {Name: "map[string]interface{}"},
+}
+
+// contractFieldGoTypes maps every contract field type to the go type used in the api service contracts
+var contractFieldGoTypes = map[string]goType{
+	fluid.ContractFieldTypeFile:     {Name: "[]byte"},
+	fluid.ContractFieldTypeBinary:   {Name: "[]byte"},
+	fluid.ContractFieldTypeString:   {Name: "string"},
+	fluid.ContractFieldTypeUuid:     {Name: "string"},
+	fluid.ContractFieldTypeDate:     {Name: "time.Time", Import: goImportTime},
+	fluid.ContractFieldTypeDateTime: {Name: "time.Time", Import: goImportTime},
+	fluid.ContractFieldTypeTime:     {Name: "time.Time", Import: goImportTime},
+	fluid.ContractFieldTypeInteger:  {Name: "int64"},
+	fluid.ContractFieldTypeDecimal:  {Name: "float64"},
+	fluid.ContractFieldTypeBoolean:  {Name: "bool"},
+	fluid.ContractFieldTypeMoney:    {Name: "int64"}, // stored as an integer to 10^5 precision
+}
+
+func lookupGoType(types map[string]goType, kind, fieldType string) (goType, error) {
+	if t, ok := types[strings.ToLower(fieldType)]; ok {
+		return t, nil
+	}
+	return goType{}, fmt.Errorf("%s field type '%s' has no go type mapping", kind, fieldType)
+}
+
+// goTypeName decorates a go type for multiple values (slice) or optional values (pointer), types that can already be nil are never pointers
+func goTypeName(t goType, multiple, optional bool) string {
+	if multiple {
+		return "[]" + t.Name
+	}
+	if optional && !strings.HasPrefix(t.Name, "[]") && !strings.HasPrefix(t.Name, "map[") {
+		return "*" + t.Name
+	}
+	return t.Name
+}
+
+func entityFieldGoType(field fluid.EntityField) (string, error) {
+	t, err := lookupGoType(entityFieldGoTypes, "entity", field.Type)
+	if err != nil {
+		return "", fmt.Errorf("field '%s': %w", field.Name, err)
+	}
+	return goTypeName(t, field.EnableMultipleValueSupport, field.IsOptional), nil
+}
+
+func contractFieldGoType(field fluid.ContractField) (string, error) {
+	t, err := lookupGoType(contractFieldGoTypes, "contract", field.Type)
+	if err != nil {
+		return "", fmt.Errorf("field '%s': %w", field.Name, err)
+	}
+	return goTypeName(t, field.EnableMultipleValueSupport, false), nil
+}
+
+// goImports renders an import block for the given packages, or nothing when there are none
+func goImports(packages map[string]bool) string {
+	var sorted []string
+	for p := range packages {
+		if p != "" {
+			sorted = append(sorted, p)
+		}
+	}
+	if len(sorted) <= 0 {
+		return ""
+	}
+	sort.Strings(sorted)
+
+	imports := "\nimport (\n"
+	for _, p := range sorted {
+		imports += fmt.Sprintf("\t%q\n", p)
+	}
+	return imports + ")\n"
+}
+
+// hasEntityIdField reports whether the schema defines its own id field, otherwise an object id is generated
+func hasEntityIdField(entity fluid.Entity) bool {
+	for _, field := range entity.Fields {
+		if kebabCase(field.Name) == "id" {
+			return true
+		}
+	}
+	return false
+}
+
+func entityGoImports(entity fluid.Entity, extension EntityExtension) string {
+	packages := map[string]bool{}
+	if !hasEntityIdField(entity) || len(extension.Links) > 0 {
+		packages[goImportPrimitive] = true
+	}
+	for _, field := range append(entity.Fields, entityAuditFields(entity)...) {
+		if t, ok := entityFieldGoTypes[strings.ToLower(field.Type)]; ok {
+			packages[t.Import] = true
+		}
+	}
+	return goImports(packages)
+}
+
+func contractGoImports(contract fluid.Contract) string {
+	packages := map[string]bool{}
+	for _, field := range append(contract.Fields, contractAuditFields(contract)...) {
+		if t, ok := contractFieldGoTypes[strings.ToLower(field.Type)]; ok {
+			packages[t.Import] = true
+		}
+	}
+	return goImports(packages)
+}